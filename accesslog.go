@@ -0,0 +1,261 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	respCodeKey      = "svc_resp_code"
+	respErrorKey     = "svc_resp_error"
+	respBodyKey      = "svc_resp_body"
+	accessLogBodyKey = "svc_access_log_body"
+	redacted         = "******"
+
+	maxRedactBodySize = 1 << 20 // of the bodies read whole for redaction, the larger ones are not logged
+)
+
+type AccessLogOption struct {
+	Logger      *slog.Logger
+	SampleRate  float64  // of the requests below 400 logged, 1 logs all of them
+	LogBodies   bool     // logs the decrypted request and response bodies
+	MaxBodySize int      // of the bodies logged, the rest of the redacted body is truncated
+	Redact      []string // the JSON or form keys of the bodies redacted, case insensitive
+	Skip        func(ctx *gin.Context) (skip bool)
+}
+
+// AccessLog logs a record per request at Info, Warn for 4xx and Error for 5xx,
+// dropped below the LogLevel of the App Settings
+func AccessLog(configure ...func(opt *AccessLogOption)) gin.HandlerFunc {
+	opt := AccessLogOption{
+		SampleRate:  1,
+		MaxBodySize: 4 << 10,
+		Redact:      []string{"password", "token", "secret", "authorization", "aes_key"},
+	}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	return func(ctx *gin.Context) {
+		if opt.Skip != nil && opt.Skip(ctx) {
+			ctx.Next()
+			return
+		}
+		var reqBody, respBody *limitedBuffer
+		if opt.LogBodies {
+			ctx.Set(accessLogBodyKey, true)
+			reqBody, respBody = &limitedBuffer{max: maxRedactBodySize}, &limitedBuffer{max: maxRedactBodySize}
+			if ctx.Request.Body != nil {
+				ctx.Request.Body = readCloser{io.TeeReader(ctx.Request.Body, reqBody), ctx.Request.Body}
+			}
+			ctx.Writer = &bodyLogWriter{ResponseWriter: ctx.Writer, body: respBody}
+		}
+		start := time.Now()
+		ctx.Next()
+		latency := time.Since(start)
+
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case opt.SampleRate < 1 && rand.Float64() >= opt.SampleRate:
+			return
+		}
+		if s := appOf(ctx).snapshot(); s != nil && level < logLevel(s.LogLevel) {
+			return
+		}
+		logger := opt.Logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		if !logger.Enabled(ctx.Request.Context(), level) {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", ctx.FullPath()),
+			slog.String("path", ctx.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", latency),
+			slog.Int("bytes", ctx.Writer.Size()),
+			slog.String("ip", ctx.ClientIP()),
+			slog.String("request_id", RequestIDOf(ctx)),
+		}
+		if code, ok := ctx.Get(respCodeKey); ok {
+			attrs = append(attrs, slog.Any("code", code))
+		}
+		if msg := ctx.GetString(respErrorKey); msg != "" {
+			attrs = append(attrs, slog.String("error", msg))
+		}
+		if opt.LogBodies {
+			attrs = append(attrs,
+				slog.String("req_body", redactBody(requestBodyOf(ctx, reqBody), opt)),
+				slog.String("resp_body", redactBody(responseBodyOf(ctx, respBody), opt)))
+		}
+		logger.LogAttrs(context.Background(), level, "access", attrs...)
+	}
+}
+
+func logLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelDebug
+	}
+	return l
+}
+
+// loggedBody is a body of the access log, size is the length of it when only a part of it was kept
+type loggedBody struct {
+	data []byte
+	size int
+}
+
+// requestBodyOf returns the decrypted request body when Decryption decrypted it
+func requestBodyOf(ctx *gin.Context, read *limitedBuffer) loggedBody {
+	switch data := ctx.Value("encryption_data").(type) {
+	case []byte:
+		return loggedBody{data, len(data)}
+	case url.Values:
+		encoded := []byte(data.Encode())
+		return loggedBody{encoded, len(encoded)}
+	}
+	return loggedBody{read.Bytes(), read.size}
+}
+
+// responseBodyOf returns the plain response body WriteJSON marshalled, the bytes written otherwise
+func responseBodyOf(ctx *gin.Context, written *limitedBuffer) loggedBody {
+	if data, ok := ctx.Value(respBodyKey).([]byte); ok {
+		return loggedBody{data, len(data)}
+	}
+	if ctx.Writer.Header().Get("Encryption") != "" {
+		return loggedBody{}
+	}
+	return loggedBody{written.Bytes(), written.size}
+}
+
+// redactBody replaces the values of the keys of opt.Redact in whole JSON or form bodies, then truncates them at opt.MaxBodySize,
+// the bodies not parsed, or not kept whole, are logged by their size only
+func redactBody(body loggedBody, opt AccessLogOption) string {
+	if body.size == 0 {
+		return ""
+	}
+	out, ok := "", false
+	if len(body.data) == body.size {
+		out, ok = redactParsed(body.data, opt.Redact)
+	}
+	if !ok {
+		return fmt.Sprintf("<unparsed %d bytes>", body.size)
+	}
+	if len(out) > opt.MaxBodySize {
+		out = out[:opt.MaxBodySize]
+	}
+	return out
+}
+
+func redactParsed(body []byte, keys []string) (string, bool) {
+	var v any
+	if jsonEngine.Unmarshal(body, &v) == nil {
+		if buf, err := jsonEngine.Marshal(redactValue(v, keys)); err == nil {
+			return string(buf), true
+		}
+	}
+	if values, err := url.ParseQuery(string(body)); err == nil && len(values) > 0 && bytes.IndexByte(body, '=') > 0 {
+		for k := range values {
+			if containsFold(keys, k) {
+				values[k] = []string{redacted}
+			}
+		}
+		return values.Encode(), true
+	}
+	return "", false
+}
+
+func redactValue(v any, keys []string) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, value := range vv {
+			if containsFold(keys, k) {
+				vv[k] = redacted
+			} else {
+				vv[k] = redactValue(value, keys)
+			}
+		}
+	case []any:
+		for i, value := range vv {
+			vv[i] = redactValue(value, keys)
+		}
+	}
+	return v
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitedBuffer keeps the first max bytes written to it, counting all of them in size
+type limitedBuffer struct {
+	bytes.Buffer
+	max  int
+	size int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.size += len(p)
+	if rest := b.max - b.Len(); rest > 0 {
+		if len(p) > rest {
+			b.Buffer.Write(p[:rest])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body *limitedBuffer
+}
+
+func (w *bodyLogWriter) Write(p []byte) (int, error) {
+	_, _ = w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *bodyLogWriter) WriteString(s string) (int, error) {
+	_, _ = w.body.Write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccessLogRedactsLargeBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	app := New()
+	app.Use(AccessLog(func(opt *AccessLogOption) {
+		opt.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+		opt.LogBodies = true
+	}))
+	app.POST("/login", func(ctx *gin.Context) {
+		_, _ = io.ReadAll(ctx.Request.Body)
+		ctx.Status(http.StatusNoContent)
+	})
+	post := func(contentType, body string) string {
+		logs.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		app.ServeHTTP(httptest.NewRecorder(), req)
+		return logs.String()
+	}
+	pad := strings.Repeat("x", 5<<10)
+	if out := post("application/json", `{"zpad":"`+pad+`","password":"hunter2"}`); strings.Contains(out, "hunter2") || !strings.Contains(out, redacted) {
+		t.Fatalf("the password of a body over MaxBodySize leaked: %s", out)
+	}
+	if out := post("application/x-www-form-urlencoded", "pad="+pad+"&password=hunter2"); strings.Contains(out, "hunter2") {
+		t.Fatalf("the password of a form over MaxBodySize leaked: %s", out)
+	}
+	if out := post("text/plain", "password: hunter2 "+pad); strings.Contains(out, "hunter2") || !strings.Contains(out, "<unparsed 5138 bytes>") {
+		t.Fatalf("an unparsed body was logged: %s", out)
+	}
+}
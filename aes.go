@@ -4,10 +4,31 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
+	"time"
 )
 
 func AesEncrypt(plainText []byte) (string, error) {
-	key := []byte(AesKey())
+	return defaultApp.encrypt(defaultApp.Settings().AesKey, plainText)
+}
+
+func AesDecrypt(cipherBytes []byte) ([]byte, error) {
+	return defaultApp.decrypt(defaultApp.Settings().AesKey, cipherBytes)
+}
+
+// encrypt is aesEncrypt recording the crypto metrics of app
+func (app *App) encrypt(aesKey string, plainText []byte) (cipherText string, err error) {
+	defer app.observeCrypto("encrypt", time.Now(), &err)
+	return aesEncrypt(aesKey, plainText)
+}
+
+// decrypt is aesDecrypt recording the crypto metrics of app
+func (app *App) decrypt(aesKey string, cipherBytes []byte) (plainText []byte, err error) {
+	defer app.observeCrypto("decrypt", time.Now(), &err)
+	return aesDecrypt(aesKey, cipherBytes)
+}
+
+func aesEncrypt(aesKey string, plainText []byte) (string, error) {
+	key := []byte(aesKey)
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -18,9 +39,12 @@ func AesEncrypt(plainText []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(cipherText[:]), nil
 }
 
-func AesDecrypt(cipherBytes []byte) ([]byte, error) {
+func aesDecrypt(aesKey string, cipherBytes []byte) ([]byte, error) {
 	decodeText, err := base64.StdEncoding.DecodeString(string(cipherBytes))
-	key := []byte(AesKey())
+	if err != nil {
+		return nil, err
+	}
+	key := []byte(aesKey)
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
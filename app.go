@@ -11,10 +11,172 @@
 
 package svc
 
-import "github.com/gin-gonic/gin"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
 
-var engine = gin.New()
+	"github.com/gin-gonic/gin"
+)
 
-func GetApp(middlewares ...gin.HandlerFunc) *gin.Engine { engine.Use(middlewares...); return engine }
+// App owns a gin engine and the svc configuration of the routes registered on it
+type App struct {
+	*gin.Engine
 
-func GetAppWithGroup(prefix string) *gin.RouterGroup { return GetApp().Group(prefix) }
+	settings             atomic.Value // *Settings, unset uses the package EncryptEnable, DecryptEnable and AesKey
+	envelope             Envelope
+	validatorLangSupport []string
+	validatorLangFunc    func(ctx *gin.Context) (lang string)
+	errorMappers         []ErrorMapper
+	config               *Config
+	metrics              MetricsRegistry
+	authzAudit           AuthzAudit
+
+	state   int32
+	onStart []Hook
+	onStop  []Hook
+
+	wsMu    sync.Mutex
+	wsConns map[wsCloser]struct{} // the open WebSocket connections, closed on shutdown
+}
+
+type (
+	Option func(app *App)
+
+	Encryption struct {
+		EncryptEnable bool
+		DecryptEnable bool
+		AesKey        string
+	}
+
+	// Envelope builds the response body from the business code, message and data,
+	// the request id of the error responses is answered in the RequestIDHeader instead
+	Envelope func(code int, msg string, data any) any
+
+	// ErrorMapper maps the errors written to responses, e.g. a not found error of gorm to a 404 *Error,
+	// returning err itself when it is not mapped
+	ErrorMapper func(err error) error
+)
+
+var defaultApp = New()
+
+// New creates an App with its own gin engine, the routes of it find the App from the request context
+func New(opts ...Option) *App {
+	app := &App{Engine: gin.New(), validatorLangFunc: defaultValidatorLangFunc}
+	app.Use(func(ctx *gin.Context) { ctx.Set(appKey, app); ctx.Next() }, settingsCors(app))
+	for _, opt := range opts {
+		if opt != nil {
+			opt(app)
+		}
+	}
+	return app
+}
+
+// WithEncryption sets the encryption of the Settings, New panics when they are invalid, like an AesKey not of 16 bytes
+func WithEncryption(encryption Encryption) Option {
+	return func(app *App) {
+		s := app.Settings()
+		s.EncryptEnable, s.DecryptEnable, s.AesKey = encryption.EncryptEnable, encryption.DecryptEnable, encryption.AesKey
+		if err := app.SetSettings(s); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func WithEnvelope(envelope Envelope) Option { return func(app *App) { app.envelope = envelope } }
+
+func WithValidatorLang(fn func(ctx *gin.Context) (lang string), lang ...string) Option {
+	return func(app *App) { app.validatorLangFunc, app.validatorLangSupport = fn, lang }
+}
+
+func WithErrorMappers(mappers ...ErrorMapper) Option {
+	return func(app *App) { app.errorMappers = append(app.errorMappers, mappers...) }
+}
+
+func WithMiddlewares(middlewares ...gin.HandlerFunc) Option {
+	return func(app *App) { app.Use(middlewares...) }
+}
+
+const appKey = "svc_app"
+
+// appOf returns the App of the request, the default App for engines not created by New
+func appOf(ctx *gin.Context) *App {
+	if ctx != nil {
+		if value, ok := ctx.Get(appKey); ok {
+			if app, okk := value.(*App); okk {
+				return app
+			}
+		}
+	}
+	return defaultApp
+}
+
+// appOfContext returns the App of a *gin.Context, the default App for other contexts
+func appOfContext(ctx context.Context) *App {
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		return appOf(ginCtx)
+	}
+	return defaultApp
+}
+
+func (app *App) encryptEnabled() bool { return app.Settings().EncryptEnable }
+
+func (app *App) decryptEnabled() bool { return app.Settings().DecryptEnable }
+
+// encrypts reports whether a route declared by encrypts is encrypted
+func (app *App) encrypts(encrypts ...bool) bool {
+	return len(encrypts) > 0 && encrypts[0] && app.encryptEnabled()
+}
+
+func (app *App) aesEncrypt(plainText []byte) (string, error) {
+	return app.encrypt(app.Settings().AesKey, plainText)
+}
+
+// encryptTo encrypts plainText by the current key, declaring it by the encryption headers of header
+func (app *App) encryptTo(header http.Header, contentType string, plainText []byte) (string, error) {
+	s := app.Settings()
+	header.Set("Encryption", "Yes")
+	if contentType != "" {
+		header.Set("Encryption-Content-Type", contentType)
+	}
+	if s.AesKeyID != "" {
+		header.Set(encryptionKeyIDHeader, s.AesKeyID)
+	}
+	return app.encrypt(s.AesKey, plainText)
+}
+
+// aesDecrypt decrypts by the key of keyID, the current key when keyID is empty or the current id
+func (app *App) aesDecrypt(keyID string, cipherBytes []byte) ([]byte, error) {
+	s := app.Settings()
+	key := s.AesKey
+	if keyID != "" && keyID != s.AesKeyID {
+		var ok bool
+		if key, ok = s.AesKeyring[keyID]; !ok {
+			return nil, fmt.Errorf("svc: unknown encryption key id %s", keyID)
+		}
+	}
+	return app.decrypt(key, cipherBytes)
+}
+
+var defaultMiddlewares int32
+
+// GetApp returns the gin engine of the default App, middlewares are used once by the first call passing them
+// and ignored with a warning later, New(WithMiddlewares(...)) builds an App owning its middlewares instead
+func GetApp(middlewares ...gin.HandlerFunc) *gin.Engine {
+	if len(middlewares) > 0 {
+		if atomic.CompareAndSwapInt32(&defaultMiddlewares, 0, 1) {
+			defaultApp.Use(middlewares...)
+		} else {
+			slog.Warn("svc: GetApp middlewares are already used, ignoring", "count", len(middlewares))
+		}
+	}
+	return defaultApp.Engine
+}
+
+func GetAppWithGroup(prefix string) *gin.RouterGroup { return defaultApp.Group(prefix) }
+
+// GetDefaultApp returns the App behind GetApp
+func GetDefaultApp() *App { return defaultApp }
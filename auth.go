@@ -0,0 +1,211 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject     string         `json:"subject"`
+	Method      string         `json:"method"` // jwt, api_key or basic
+	Roles       []string       `json:"roles,omitempty"`
+	Permissions []string       `json:"permissions,omitempty"`
+	Claims      map[string]any `json:"claims,omitempty"`
+}
+
+// clone copies p, so a request changing its principal leaves the principal of the provider intact
+func (p *Principal) clone() *Principal {
+	c := *p
+	c.Roles = append([]string(nil), p.Roles...)
+	c.Permissions = append([]string(nil), p.Permissions...)
+	if p.Claims != nil {
+		c.Claims = make(map[string]any, len(p.Claims))
+		for k, v := range p.Claims {
+			c.Claims[k] = v
+		}
+	}
+	return &c
+}
+
+// AuthProvider authenticates a request, returning ErrNoCredentials when it carries none of its credentials
+type AuthProvider interface {
+	Authenticate(req *http.Request) (principal any, err error)
+}
+
+// challenger is the AuthProvider declaring a WWW-Authenticate challenge
+type challenger interface{ Challenge() string }
+
+var (
+	ErrNoCredentials = errors.New("svc: no credentials")
+	ErrUnauthorized  = NewErrorWithCodes("unauthorized", http.StatusUnauthorized, http.StatusUnauthorized)
+	ErrForbidden     = NewErrorWithCodes("forbidden", http.StatusForbidden, http.StatusForbidden)
+)
+
+const principalKey = "svc_principal"
+
+type principalCtxKey struct{}
+
+type AuthOption struct {
+	Providers []AuthProvider
+	Optional  bool // lets the requests without credentials through unauthenticated
+}
+
+// Auth authenticates the requests by the first provider finding credentials in them,
+// the failures are written as 401 or the codes of the *Error returned by the provider
+func Auth(configure ...func(opt *AuthOption)) gin.HandlerFunc {
+	var opt AuthOption
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	return func(ctx *gin.Context) {
+		for _, provider := range opt.Providers {
+			principal, err := provider.Authenticate(ctx.Request)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			if err != nil {
+				abortAuth(ctx, opt.Providers, err)
+				return
+			}
+			ctx.Set(principalKey, principal)
+			ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), principalCtxKey{}, principal))
+			ctx.Next()
+			return
+		}
+		if opt.Optional {
+			ctx.Next()
+			return
+		}
+		abortAuth(ctx, opt.Providers, ErrUnauthorized)
+	}
+}
+
+func abortAuth(ctx *gin.Context, providers []AuthProvider, err error) {
+	var cusErr *Error
+	if !errors.As(err, &cusErr) {
+		err = ErrUnauthorized
+	}
+	for _, provider := range providers {
+		if c, ok := provider.(challenger); ok {
+			ctx.Writer.Header().Add("WWW-Authenticate", c.Challenge())
+		}
+	}
+	ctx.Abort()
+	WriteJSON(ctx, http.StatusUnauthorized, http.StatusUnauthorized, "", err, nil)
+}
+
+// PrincipalOf returns the principal of type P authenticated by Auth, ctx is the *gin.Context or its request context
+func PrincipalOf[P any](ctx context.Context) (principal P, ok bool) {
+	value := requestContext(ctx).Value(principalCtxKey{})
+	if value == nil {
+		if ginCtx, okk := ctx.(*gin.Context); okk {
+			value, _ = ginCtx.Get(principalKey)
+		}
+	}
+	principal, ok = value.(P)
+	return
+}
+
+type APIKeyOption struct {
+	Header string
+	Query  string // of the query parameter also carrying the key, empty disables it
+}
+
+// APIKeyProvider authenticates the static API keys of keys, the keys of nil principals are skipped
+func APIKeyProvider(keys map[string]*Principal, configure ...func(opt *APIKeyOption)) AuthProvider {
+	opt := APIKeyOption{Header: "X-Api-Key"}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	hashed := make(map[[sha256.Size]byte]*Principal, len(keys))
+	for key, principal := range keys {
+		if principal == nil {
+			continue
+		}
+		p := principal.clone()
+		p.Method = "api_key"
+		hashed[sha256.Sum256([]byte(key))] = p
+	}
+	return &apiKeyProvider{opt: opt, keys: hashed}
+}
+
+type apiKeyProvider struct {
+	opt  APIKeyOption
+	keys map[[sha256.Size]byte]*Principal // by the hash of the key, not comparing the keys in variable time
+}
+
+func (p *apiKeyProvider) Authenticate(req *http.Request) (any, error) {
+	key := req.Header.Get(p.opt.Header)
+	if key == "" && p.opt.Query != "" {
+		key = req.URL.Query().Get(p.opt.Query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	if principal, ok := p.keys[sha256.Sum256([]byte(key))]; ok {
+		return principal.clone(), nil
+	}
+	return nil, NewErrorWithCodes("invalid api key", http.StatusUnauthorized, http.StatusUnauthorized)
+}
+
+// BasicProvider authenticates HTTP Basic credentials by verify, returning nil principal for wrong ones
+func BasicProvider(realm string, verify func(username, password string) (principal *Principal)) AuthProvider {
+	return &basicProvider{realm: realm, verify: verify}
+}
+
+// BasicUsers verifies the passwords of users by username
+func BasicUsers(users map[string]string) func(username, password string) *Principal {
+	return func(username, password string) *Principal {
+		want, ok := users[username]
+		given, wanted := sha256.Sum256([]byte(password)), sha256.Sum256([]byte(want))
+		if subtle.ConstantTimeCompare(given[:], wanted[:]) == 1 && ok {
+			return &Principal{Subject: username}
+		}
+		return nil
+	}
+}
+
+type basicProvider struct {
+	realm  string
+	verify func(username, password string) *Principal
+}
+
+func (p *basicProvider) Authenticate(req *http.Request) (any, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	principal := p.verify(username, password)
+	if principal == nil {
+		return nil, NewErrorWithCodes("invalid username or password", http.StatusUnauthorized, http.StatusUnauthorized)
+	}
+	principal = principal.clone()
+	principal.Method = "basic"
+	return principal, nil
+}
+
+func (p *basicProvider) Challenge() string {
+	return `Basic realm="` + strings.ReplaceAll(p.realm, `"`, "") + `"`
+}
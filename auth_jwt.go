@@ -0,0 +1,320 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type JWTOption struct {
+	Secret           []byte           // of HS256, HS384 and HS512
+	PublicKey        crypto.PublicKey // *rsa.PublicKey of RS and PS, *ecdsa.PublicKey of ES
+	JWKSFile         string           // of the keys by kid
+	JWKSURL          string           // of the keys by kid, refetched after JWKSRefresh, its oct keys are never used for HS256, HS384 and HS512
+	JWKSRefresh      time.Duration
+	Issuer           string
+	Audience         string
+	Leeway           time.Duration
+	RolesClaim       string
+	PermissionsClaim string // an array, or a space separated string like scope
+}
+
+// JWTProvider authenticates the bearer tokens of the Authorization header,
+// only the algorithms of the configured keys are accepted
+func JWTProvider(configure ...func(opt *JWTOption)) AuthProvider {
+	opt := JWTOption{JWKSRefresh: 10 * time.Minute, RolesClaim: "roles", PermissionsClaim: "scope"}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	p := &jwtProvider{opt: opt}
+	var methods []string
+	if len(opt.Secret) > 0 {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	switch opt.PublicKey.(type) {
+	case *rsa.PublicKey:
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+	case *ecdsa.PublicKey:
+		methods = append(methods, "ES256", "ES384", "ES512")
+	}
+	if opt.JWKSFile != "" || opt.JWKSURL != "" {
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512")
+	}
+	if opt.JWKSFile != "" {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	parserOpts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithLeeway(opt.Leeway), jwt.WithExpirationRequired()}
+	if opt.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opt.Issuer))
+	}
+	if opt.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opt.Audience))
+	}
+	p.parser = jwt.NewParser(parserOpts...)
+	return p
+}
+
+type jwtProvider struct {
+	opt    JWTOption
+	parser *jwt.Parser
+
+	mu        sync.Mutex
+	jwks      map[string]any
+	fetchedAt time.Time
+	jwksErr   error         // of the last reload
+	reloading chan struct{} // closed once the reload in flight is done
+}
+
+func (p *jwtProvider) Authenticate(req *http.Request) (any, error) {
+	auth := req.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+	claims := jwt.MapClaims{}
+	if _, err := p.parser.ParseWithClaims(strings.TrimSpace(auth[7:]), claims, p.key); err != nil {
+		msg := "invalid token"
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			msg = "token expired"
+		}
+		return nil, NewErrorWithCodes(msg, http.StatusUnauthorized, http.StatusUnauthorized)
+	}
+	principal := &Principal{Method: "jwt", Claims: claims}
+	principal.Subject, _ = claims.GetSubject()
+	principal.Roles = claimStrings(claims[p.opt.RolesClaim])
+	principal.Permissions = claimStrings(claims[p.opt.PermissionsClaim])
+	return principal, nil
+}
+
+func (p *jwtProvider) Challenge() string { return "Bearer" }
+
+// claimStrings reads a claim of a string array or a space separated string
+func claimStrings(claim any) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []any:
+		values := make([]string, 0, len(c))
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (p *jwtProvider) key(token *jwt.Token) (any, error) {
+	_, hmac := token.Method.(*jwt.SigningMethodHMAC)
+	// the HMAC tokens never verify by the keys of a JWKS URL, which are public
+	if kid, _ := token.Header["kid"].(string); kid != "" && (p.opt.JWKSFile != "" || p.opt.JWKSURL != "" && !hmac) {
+		key, err := p.jwksKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		return matchKey(token.Method, key)
+	}
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(p.opt.Secret) > 0 {
+			return p.opt.Secret, nil
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		if p.opt.PublicKey != nil {
+			return matchKey(token.Method, p.opt.PublicKey)
+		}
+	}
+	return nil, fmt.Errorf("svc: no key of %s", token.Method.Alg())
+}
+
+// matchKey returns key when it is of the key type of method, preventing algorithm confusion
+func matchKey(method jwt.SigningMethod, key any) (any, error) {
+	ok := false
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok = key.([]byte)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, ok = key.(*ecdsa.PublicKey)
+	}
+	if !ok {
+		return nil, fmt.Errorf("svc: key of %T does not match %s", key, method.Alg())
+	}
+	return key, nil
+}
+
+// jwksKey returns the key of kid, reloading the JWKS when it is stale or misses kid,
+// at most once per 10 seconds for the missing kids. A stale key is returned at once while the JWKS reloads,
+// only the requests of the missing kids wait for the reload
+func (p *jwtProvider) jwksKey(kid string) (any, error) {
+	p.mu.Lock()
+	key, ok := p.jwks[kid]
+	stale := p.jwks == nil || p.opt.JWKSURL != "" && time.Since(p.fetchedAt) >= p.opt.JWKSRefresh
+	if ok && !stale {
+		p.mu.Unlock()
+		return key, nil
+	}
+	if !ok && !stale && time.Since(p.fetchedAt) < 10*time.Second {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("svc: unknown kid %s", kid)
+	}
+	reloaded := p.reloadJWKS()
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	<-reloaded
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok = p.jwks[kid]; ok {
+		return key, nil
+	}
+	if p.jwksErr != nil {
+		return nil, p.jwksErr
+	}
+	return nil, fmt.Errorf("svc: unknown kid %s", kid)
+}
+
+// reloadJWKS starts reloading the JWKS unless a reload is in flight, not holding p.mu while loading,
+// the returned channel is closed once it is done. p.mu is held by the caller
+func (p *jwtProvider) reloadJWKS() <-chan struct{} {
+	if p.reloading == nil {
+		reloading := make(chan struct{})
+		p.reloading = reloading
+		go func() {
+			keys, err := p.loadJWKS()
+			p.mu.Lock()
+			if err == nil {
+				p.jwks, p.fetchedAt = keys, time.Now()
+			}
+			p.jwksErr, p.reloading = err, nil
+			p.mu.Unlock()
+			close(reloading)
+		}()
+	}
+	return p.reloading
+}
+
+func (p *jwtProvider) loadJWKS() (map[string]any, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if p.opt.JWKSFile != "" {
+		data, err = os.ReadFile(p.opt.JWKSFile)
+	} else {
+		var resp *http.Response
+		if resp, err = (&http.Client{Timeout: 10 * time.Second}).Get(p.opt.JWKSURL); err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("svc: jwks %s: %s", p.opt.JWKSURL, resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS returns the verification keys of a JWK set by kid, the keys of use enc skipped
+func ParseJWKS(data []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := jsonEngine.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("svc: jwk %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported kty %s", k.Kty)
+}
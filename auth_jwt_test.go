@@ -0,0 +1,188 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	return `{"kid":"` + kid + `","kty":"RSA","n":"` + b64(key.N.Bytes()) + `","e":"` + b64(big.NewInt(int64(key.E)).Bytes()) + `"}`
+}
+
+// jwksServer serves the JWK set of *set
+func jwksServer(t *testing.T, set *atomic.Value) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys":[` + set.Load().(string) + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func authenticateBearer(p AuthProvider, token string) (any, error) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return p.Authenticate(req)
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+func TestJWTAlgConfusion(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	var set atomic.Value
+	set.Store(rsaJWK("k1", &rsaKey.PublicKey) + `,{"kid":"hs","kty":"oct","k":"` + base64.RawURLEncoding.EncodeToString([]byte("secret")) + `"}`)
+	p := JWTProvider(func(opt *JWTOption) { opt.JWKSURL = jwksServer(t, &set) })
+	if _, err := authenticateBearer(p, signToken(t, jwt.SigningMethodRS256, "k1", rsaKey, validClaims())); err != nil {
+		t.Fatalf("RS256 of the JWKS key: %v", err)
+	}
+	if _, err := authenticateBearer(p, signToken(t, jwt.SigningMethodHS256, "hs", []byte("secret"), validClaims())); err == nil {
+		t.Fatal("HS256 verified by an oct key of the JWKS URL")
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if _, err := authenticateBearer(p, signToken(t, jwt.SigningMethodHS256, "k1", der, validClaims())); err == nil {
+		t.Fatal("HS256 verified by the RSA public key of the JWKS URL")
+	}
+	pk := JWTProvider(func(opt *JWTOption) { opt.PublicKey = &rsaKey.PublicKey })
+	if _, err := authenticateBearer(pk, signToken(t, jwt.SigningMethodHS256, "", der, validClaims())); err == nil {
+		t.Fatal("HS256 verified by the RSA PublicKey")
+	}
+}
+
+func TestJWTKidRotation(t *testing.T) {
+	key1, key2 := newRSAKey(t), newRSAKey(t)
+	var set atomic.Value
+	set.Store(rsaJWK("k1", &key1.PublicKey))
+	p := JWTProvider(func(opt *JWTOption) {
+		opt.JWKSURL, opt.JWKSRefresh = jwksServer(t, &set), time.Millisecond
+	})
+	token1 := signToken(t, jwt.SigningMethodRS256, "k1", key1, validClaims())
+	if _, err := authenticateBearer(p, token1); err != nil {
+		t.Fatalf("k1: %v", err)
+	}
+	set.Store(rsaJWK("k2", &key2.PublicKey))
+	time.Sleep(2 * time.Millisecond)
+	if _, err := authenticateBearer(p, signToken(t, jwt.SigningMethodRS256, "k2", key2, validClaims())); err != nil {
+		t.Fatalf("the rotated in k2: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	if _, err := authenticateBearer(p, token1); err == nil {
+		t.Fatal("the rotated out k1 is still accepted")
+	}
+}
+
+func TestJWKSReloadNotBlocking(t *testing.T) {
+	key := newRSAKey(t)
+	release := make(chan struct{})
+	var blocked atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocked.Load() {
+			<-release
+		}
+		_, _ = w.Write([]byte(`{"keys":[` + rsaJWK("k1", &key.PublicKey) + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	p := JWTProvider(func(opt *JWTOption) { opt.JWKSURL, opt.JWKSRefresh = srv.URL, time.Millisecond })
+	token := signToken(t, jwt.SigningMethodRS256, "k1", key, validClaims())
+	if _, err := authenticateBearer(p, token); err != nil {
+		t.Fatal(err)
+	}
+	blocked.Store(true)
+	time.Sleep(2 * time.Millisecond)
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { _, err := authenticateBearer(p, token); done <- err }()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("a stale key waited for the JWKS reload")
+		}
+	}
+}
+
+func TestJWTExpiry(t *testing.T) {
+	secret := []byte("secret")
+	p := JWTProvider(func(opt *JWTOption) { opt.Secret, opt.Leeway = secret, time.Minute })
+	for _, tc := range []struct {
+		name   string
+		claims jwt.MapClaims
+		err    string
+	}{
+		{"valid", validClaims(), ""},
+		{"in leeway", jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()}, ""},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-2 * time.Minute).Unix()}, "token expired"},
+		{"no exp", jwt.MapClaims{"sub": "u1"}, "invalid token"},
+	} {
+		_, err := authenticateBearer(p, signToken(t, jwt.SigningMethodHS256, "", secret, tc.claims))
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Fatalf("%s: got %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestAPIKeyProviderSkipsNil(t *testing.T) {
+	p := APIKeyProvider(map[string]*Principal{"a": nil, "b": {Subject: "b"}})
+	auth := func(key string) (any, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Api-Key", key)
+		return p.Authenticate(req)
+	}
+	if _, err := auth("a"); err == nil {
+		t.Fatal("the key of a nil principal is accepted")
+	}
+	if principal, err := auth("b"); err != nil || principal.(*Principal).Subject != "b" {
+		t.Fatalf("got %v, %v", principal, err)
+	}
+}
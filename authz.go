@@ -0,0 +1,194 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy decides whether principal may do action on resource, like a Casbin enforcer
+type Policy interface {
+	Allow(ctx context.Context, principal any, resource, action string) (allowed bool, err error)
+}
+
+type PolicyFunc func(ctx context.Context, principal any, resource, action string) (allowed bool, err error)
+
+func (f PolicyFunc) Allow(ctx context.Context, principal any, resource, action string) (bool, error) {
+	return f(ctx, principal, resource, action)
+}
+
+// Owned is implemented by REQ types of the resources owned by a principal, checked by OwnerOnly
+type Owned interface{ OwnerID() string }
+
+// Decision is an authorization decision, passed to the AuthzAudit of the App
+type Decision struct {
+	Time      time.Time
+	Principal any
+	Method    string
+	Route     string
+	Resource  string
+	Action    string
+	Allowed   bool
+	Reason    string
+}
+
+type AuthzAudit func(ctx context.Context, decision Decision)
+
+func WithAuthzAudit(audit AuthzAudit) Option { return func(app *App) { app.authzAudit = audit } }
+
+// RequireRoles allows the principals of any of roles, the authenticated principals not of *Principal are forbidden
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	action := "role:" + strings.Join(roles, ",")
+	return func(ctx *gin.Context) {
+		principal, authenticated := PrincipalOf[any](ctx)
+		p, ok := principal.(*Principal)
+		allowed := ok && p != nil && containsAny(p.Roles, roles)
+		authorize(ctx, principal, authenticated, routeOf(ctx), action, allowed, nil)
+	}
+}
+
+// RequirePermissions allows the principals of all of permissions, granted exactly or by a wildcard like orders:*,
+// the authenticated principals not of *Principal are forbidden
+func RequirePermissions(permissions ...string) gin.HandlerFunc {
+	action := "permission:" + strings.Join(permissions, ",")
+	return func(ctx *gin.Context) {
+		principal, authenticated := PrincipalOf[any](ctx)
+		p, ok := principal.(*Principal)
+		allowed := ok && p != nil
+		for _, permission := range permissions {
+			allowed = allowed && hasPermission(p.Permissions, permission)
+		}
+		authorize(ctx, principal, authenticated, routeOf(ctx), action, allowed, nil)
+	}
+}
+
+// RequirePolicy allows the principals policy allows to do action on the route
+func RequirePolicy(policy Policy, action string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := ctx.Get(principalKey)
+		allowed := false
+		var err error
+		if ok {
+			allowed, err = policy.Allow(ctx, principal, routeOf(ctx), action)
+		}
+		authorize(ctx, principal, ok, routeOf(ctx), action, allowed, err)
+	}
+}
+
+// OwnerOnly allows the REQ implementing Owned, by value or pointer receiver, to the principal owning it
+// and the principals of bypassRoles, a nil REQ of an owned type is denied
+func OwnerOnly(bypassRoles ...string) Interceptor {
+	return func(ctx *gin.Context, req any, next Handler) (any, error) {
+		owned, declared := ownedOf(req)
+		if !declared {
+			return next(ctx, req)
+		}
+		principal, authenticated := PrincipalOf[any](ctx)
+		resource, allowed, err := routeOf(ctx), false, errNilOwned
+		if owned != nil {
+			p, ok := principal.(*Principal)
+			resource, err = resource+"#"+owned.OwnerID(), nil
+			allowed = ok && p != nil && (p.Subject == owned.OwnerID() || containsAny(p.Roles, bypassRoles))
+		}
+		if dErr := decide(ctx, principal, authenticated, resource, "owner", allowed, err); dErr != nil {
+			return nil, dErr
+		}
+		return next(ctx, req)
+	}
+}
+
+var (
+	ownedType   = reflect.TypeOf((*Owned)(nil)).Elem()
+	errNilOwned = errors.New("owned req is nil")
+)
+
+// ownedOf returns req as Owned, trying a pointer to it as invoke passes REQ by value,
+// declared reports whether the type of req is owned, when owned is nil for a nil req
+func ownedOf(req any) (owned Owned, declared bool) {
+	rv := reflect.ValueOf(req)
+	if !rv.IsValid() {
+		return nil, false
+	}
+	if o, ok := req.(Owned); ok {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, true
+		}
+		return o, true
+	}
+	if rv.Kind() != reflect.Ptr && reflect.PointerTo(rv.Type()).Implements(ownedType) {
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		return ptr.Interface().(Owned), true
+	}
+	return nil, false
+}
+
+// authorize aborts the request of a denied decision with 401 or 403
+func authorize(ctx *gin.Context, principal any, authenticated bool, resource, action string, allowed bool, err error) {
+	if dErr := decide(ctx, principal, authenticated, resource, action, allowed, err); dErr != nil {
+		ctx.Abort()
+		WriteJSON(ctx, http.StatusForbidden, http.StatusForbidden, "", dErr, nil)
+		return
+	}
+	ctx.Next()
+}
+
+// decide audits the decision, returning the *Error of the denied ones
+func decide(ctx *gin.Context, principal any, authenticated bool, resource, action string, allowed bool, err error) *Error {
+	decision := Decision{
+		Time:      time.Now(),
+		Principal: principal,
+		Method:    ctx.Request.Method,
+		Route:     routeOf(ctx),
+		Resource:  resource,
+		Action:    action,
+		Allowed:   allowed && err == nil,
+	}
+	var denied *Error
+	switch {
+	case !authenticated:
+		decision.Reason, denied = "unauthenticated", ErrUnauthorized
+	case err != nil:
+		decision.Reason, denied = err.Error(), ErrForbidden
+	case !allowed:
+		decision.Reason, denied = "denied", ErrForbidden
+	}
+	if audit := appOf(ctx).authzAudit; audit != nil {
+		audit(ctx, decision)
+	}
+	return denied
+}
+
+func containsAny(values, wants []string) bool {
+	for _, want := range wants {
+		if containsString(values, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPermission(granted []string, want string) bool {
+	for _, g := range granted {
+		if g == want || g == "*" || strings.HasSuffix(g, ":*") && strings.HasPrefix(want, g[:len(g)-1]) {
+			return true
+		}
+	}
+	return false
+}
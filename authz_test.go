@@ -0,0 +1,98 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authzStatus serves a GET behind guard for principal, nil leaving the request unauthenticated
+func authzStatus(principal any, guard gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	app.GET("/r", func(ctx *gin.Context) {
+		if principal != nil {
+			ctx.Set(principalKey, principal)
+		}
+	}, guard, func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/r", nil))
+	return w.Code
+}
+
+func TestRequireRoles(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		principal any
+		roles     []string
+		want      int
+	}{
+		{"unauthenticated", nil, []string{"admin"}, http.StatusUnauthorized},
+		{"one of roles", &Principal{Roles: []string{"user", "editor"}}, []string{"admin", "editor"}, http.StatusOK},
+		{"none of roles", &Principal{Roles: []string{"user"}}, []string{"admin"}, http.StatusForbidden},
+		{"no roles", &Principal{}, []string{"admin"}, http.StatusForbidden},
+		{"not a *Principal", "admin", []string{"admin"}, http.StatusForbidden},
+		{"nil *Principal", (*Principal)(nil), []string{"admin"}, http.StatusForbidden},
+	} {
+		if got := authzStatus(tc.principal, RequireRoles(tc.roles...)); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRequirePermissions(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		principal   any
+		permissions []string
+		want        int
+	}{
+		{"unauthenticated", nil, []string{"orders:read"}, http.StatusUnauthorized},
+		{"all granted", &Principal{Permissions: []string{"orders:read", "users:read"}}, []string{"orders:read", "users:read"}, http.StatusOK},
+		{"one missing", &Principal{Permissions: []string{"orders:read"}}, []string{"orders:read", "users:read"}, http.StatusForbidden},
+		{"by wildcard", &Principal{Permissions: []string{"orders:*"}}, []string{"orders:read", "orders:write"}, http.StatusOK},
+		{"by the global wildcard", &Principal{Permissions: []string{"*"}}, []string{"users:delete"}, http.StatusOK},
+		{"not a *Principal", "orders:read", []string{"orders:read"}, http.StatusForbidden},
+		{"nil *Principal", (*Principal)(nil), []string{"orders:read"}, http.StatusForbidden},
+	} {
+		if got := authzStatus(tc.principal, RequirePermissions(tc.permissions...)); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	for _, tc := range []struct {
+		granted []string
+		want    string
+		ok      bool
+	}{
+		{[]string{"orders:read"}, "orders:read", true},
+		{[]string{"orders:read"}, "orders:write", false},
+		{[]string{"orders:*"}, "orders:read", true},
+		{[]string{"orders:*"}, "orders:items:read", true},
+		{[]string{"orders:*"}, "orders", false},
+		{[]string{"orders:*"}, "ordersx:read", false},
+		{[]string{"orders:items:*"}, "orders:read", false},
+		{[]string{"*"}, "anything", true},
+		{[]string{"orders*"}, "orders:read", false},
+		{nil, "orders:read", false},
+	} {
+		if got := hasPermission(tc.granted, tc.want); got != tc.ok {
+			t.Errorf("hasPermission(%v, %q) = %v, want %v", tc.granted, tc.want, got, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"encoding/xml"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Codec encodes and decodes the payloads of a media type
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// StrictCodec is a Codec rejecting the fields unknown to v in strict mode,
+// the codecs not implementing it decode the same way in both modes
+type StrictCodec interface {
+	Codec
+	UnmarshalStrict(data []byte, v any) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+func init() {
+	RegisterCodec(jsonMediaCodec{})
+	RegisterCodec(xmlCodec{}, "text/xml")
+}
+
+// RegisterCodec registers codec for its content type and the aliases, replacing the registered one
+func RegisterCodec(codec Codec, aliases ...string) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	for _, contentType := range append([]string{codec.ContentType()}, aliases...) {
+		codecs[mediaType(contentType)] = codec
+	}
+}
+
+// CodecFor returns the codec registered for the content type, parameters like charset ignored
+func CodecFor(contentType string) (codec Codec, ok bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok = codecs[mediaType(contentType)]
+	return
+}
+
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+const producesKey = "svc_produces"
+
+// Produces whitelists the content types the routes using it render by the Accept header,
+// the first is the default when the Accept header is missing, only JSON is rendered without it
+func Produces(contentTypes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(producesKey, contentTypes)
+		ctx.Next()
+	}
+}
+
+func negotiateCodec(ctx *gin.Context) Codec {
+	if value, ok := ctx.Get(producesKey); ok {
+		if produces, okk := value.([]string); okk && len(produces) > 0 {
+			if accepted := ctx.NegotiateFormat(produces...); accepted != "" {
+				if codec, found := CodecFor(accepted); found {
+					return codec
+				}
+			}
+		}
+	}
+	return jsonMediaCodec{}
+}
+
+type (
+	jsonMediaCodec struct{}
+	xmlCodec       struct{}
+)
+
+func (jsonMediaCodec) ContentType() string                { return binding.MIMEJSON }
+func (jsonMediaCodec) Marshal(v any) ([]byte, error)      { return jsonEngine.Marshal(v) }
+func (jsonMediaCodec) Unmarshal(data []byte, v any) error { return jsonEngine.Unmarshal(data, v) }
+
+func (xmlCodec) ContentType() string                { return binding.MIMEXML }
+func (xmlCodec) Marshal(v any) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v any) error { return xml.Unmarshal(data, v) }
@@ -0,0 +1,25 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import "github.com/fxamacker/cbor/v2"
+
+func init() { RegisterCodec(cborCodec{}) }
+
+var cborStrictMode, _ = cbor.DecOptions{ExtraReturnErrors: cbor.ExtraDecErrorUnknownField}.DecMode()
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string                      { return "application/cbor" }
+func (cborCodec) Marshal(v any) ([]byte, error)            { return cbor.Marshal(v) }
+func (cborCodec) Unmarshal(data []byte, v any) error       { return cbor.Unmarshal(data, v) }
+func (cborCodec) UnmarshalStrict(data []byte, v any) error { return cborStrictMode.Unmarshal(data, v) }
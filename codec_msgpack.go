@@ -0,0 +1,43 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nomsgpack
+
+package svc
+
+import (
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ugorji/go/codec"
+)
+
+func init() {
+	msgpackStrictHandle.ErrorIfNoField = true
+	RegisterCodec(msgpackCodec{}, "application/msgpack", "application/vnd.msgpack")
+}
+
+var msgpackHandle, msgpackStrictHandle = &codec.MsgpackHandle{WriteExt: true}, &codec.MsgpackHandle{WriteExt: true}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return binding.MIMEMSGPACK }
+
+func (msgpackCodec) Marshal(v any) (buf []byte, err error) {
+	err = codec.NewEncoderBytes(&buf, msgpackHandle).Encode(v)
+	return
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+func (msgpackCodec) UnmarshalStrict(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, msgpackStrictHandle).Decode(v)
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/gin-gonic/gin/binding"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func init() { RegisterCodec(protobufCodec{}, "application/protobuf") }
+
+var errNotProtoMessage = errors.New("value is not a proto.Message")
+
+// EnvelopeDescriptor describes the protobuf envelope of the responses:
+//
+//	syntax = "proto3";
+//	package svc;
+//	import "google/protobuf/any.proto";
+//	message Envelope {
+//	  int32 code = 1;
+//	  string msg = 2;
+//	  google.protobuf.Any data = 3;
+//	  string request_id = 4;
+//	}
+//
+// data packs the proto.Message data as is and any other data as google.protobuf.Value
+var EnvelopeDescriptor = envelopeDescriptor()
+
+func envelopeDescriptor() protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+		if typeName != "" {
+			fd.TypeName = proto.String(typeName)
+		}
+		return fd
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("svc/envelope.proto"),
+		Package:    proto.String("svc"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Envelope"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("code", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+				field("msg", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("data", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Any"),
+				field("request_id", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		panic(err)
+	}
+	return file.Messages().ByName("Envelope")
+}
+
+// protobufCodec renders the default envelope as svc.Envelope and the custom envelopes only if they are proto.Message
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return binding.MIMEPROTOBUF }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	if dd, ok := v.(kv); ok {
+		env, err := protoEnvelope(dd)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(env)
+	}
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	return nil, errNotProtoMessage
+}
+
+func protoEnvelope(dd kv) (proto.Message, error) {
+	env := dynamicpb.NewMessage(EnvelopeDescriptor)
+	fields := EnvelopeDescriptor.Fields()
+	if dd.Code != 0 {
+		env.Set(fields.ByName("code"), protoreflect.ValueOfInt32(int32(dd.Code)))
+	}
+	if dd.Msg != "" {
+		env.Set(fields.ByName("msg"), protoreflect.ValueOfString(dd.Msg))
+	}
+	if dd.RequestID != "" {
+		env.Set(fields.ByName("request_id"), protoreflect.ValueOfString(dd.RequestID))
+	}
+	if rv := reflect.ValueOf(dd.Data); dd.Data != nil && !(rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		data, err := protoData(dd.Data)
+		if err != nil {
+			return nil, err
+		}
+		env.Set(fields.ByName("data"), protoreflect.ValueOfMessage(data.ProtoReflect()))
+	}
+	return env, nil
+}
+
+func protoData(data any) (*anypb.Any, error) {
+	if m, ok := data.(proto.Message); ok {
+		return anypb.New(m)
+	}
+	buf, err := jsonEngine.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	value := &structpb.Value{}
+	if err = protojson.Unmarshal(buf, value); err != nil {
+		return nil, err
+	}
+	return anypb.New(value)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	// REQ of *pb.Message type is bound by **pb.Message
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Ptr {
+		if rv.Elem().IsNil() {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+		}
+		v = rv.Elem().Interface()
+	}
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	return errNotProtoMessage
+}
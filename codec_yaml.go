@@ -0,0 +1,39 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/yaml.v3"
+)
+
+func init() { RegisterCodec(yamlCodec{}, "application/yaml", "text/yaml") }
+
+type yamlCodec struct{}
+
+func (yamlCodec) ContentType() string                { return binding.MIMEYAML }
+func (yamlCodec) Marshal(v any) ([]byte, error)      { return yaml.Marshal(v) }
+func (yamlCodec) Unmarshal(data []byte, v any) error { return yaml.Unmarshal(data, v) }
+
+func (yamlCodec) UnmarshalStrict(data []byte, v any) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// an empty document decodes nothing like yaml.Unmarshal
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
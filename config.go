@@ -0,0 +1,257 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the svc configuration of an App, loaded by LoadConfig
+type Config struct {
+	Addr              string   `json:"addr" yaml:"addr" toml:"addr" env:"HTTP_ADDR" flag:"addr"`
+	EncryptEnable     bool     `json:"encrypt_enable" yaml:"encrypt_enable" toml:"encrypt_enable" env:"ENCRYPT_ENABLE" flag:"encrypt-enable"`
+	DecryptEnable     bool     `json:"decrypt_enable" yaml:"decrypt_enable" toml:"decrypt_enable" env:"DECRYPT_ENABLE" flag:"decrypt-enable"`
+	AesKey            string   `json:"aes_key" yaml:"aes_key" toml:"aes_key" env:"AES_KEY" flag:"aes-key"`
+	CorsOrigins       []string `json:"cors_origins" yaml:"cors_origins" toml:"cors_origins" env:"CORS_ORIGINS" flag:"cors-origins"`
+	ReadTimeout       Duration `json:"read_timeout" yaml:"read_timeout" toml:"read_timeout" env:"READ_TIMEOUT" flag:"read-timeout"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout" toml:"read_header_timeout" env:"READ_HEADER_TIMEOUT" flag:"read-header-timeout"`
+	WriteTimeout      Duration `json:"write_timeout" yaml:"write_timeout" toml:"write_timeout" env:"WRITE_TIMEOUT" flag:"write-timeout"`
+	IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout" toml:"idle_timeout" env:"IDLE_TIMEOUT" flag:"idle-timeout"`
+	ShutdownTimeout   Duration `json:"shutdown_timeout" yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout"`
+}
+
+// Duration is a time.Duration written as "30s" in files, env and flags
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) { return []byte(time.Duration(d).String()), nil }
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	dur, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+type ConfigOption struct {
+	File      string                                   // .json, .yaml, .yml or .toml, overridden by the config flag
+	LookupEnv func(key string) (value string, ok bool) // nil skips env
+	Args      []string                                 // flags, nil skips flags
+}
+
+// DefaultConfig returns the Config of the defaults of Run
+func DefaultConfig() Config {
+	return Config{
+		Addr:              ":8080",
+		ReadTimeout:       Duration(30 * time.Second),
+		ReadHeaderTimeout: Duration(10 * time.Second),
+		WriteTimeout:      Duration(30 * time.Second),
+		IdleTimeout:       Duration(120 * time.Second),
+		ShutdownTimeout:   Duration(30 * time.Second),
+	}
+}
+
+// LoadConfig loads the Config of DefaultConfig overridden by the file, env and flags in order, then validates it.
+// An env or flag value failing to parse leaves its field as it was and is reported with the others, the rest still load
+func LoadConfig(configure ...func(opt *ConfigOption)) (cfg Config, err error) {
+	opt := ConfigOption{LookupEnv: os.LookupEnv}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	cfg = DefaultConfig()
+	var flags map[string]string
+	if opt.Args != nil {
+		if flags, err = parseConfigFlags(opt.Args); err != nil {
+			return
+		}
+		if file, ok := flags["config"]; ok {
+			opt.File = file
+		}
+	}
+	if opt.File != "" {
+		if err = loadConfigFile(opt.File, &cfg); err != nil {
+			return
+		}
+	}
+	envErr := overrideConfig(&cfg, "env", func(key string) (string, bool) {
+		if opt.LookupEnv == nil {
+			return "", false
+		}
+		return opt.LookupEnv(key)
+	})
+	flagErr := overrideConfig(&cfg, "flag", func(key string) (value string, ok bool) {
+		value, ok = flags[key]
+		return
+	})
+	err = errors.Join(envErr, flagErr, cfg.Validate())
+	return
+}
+
+func loadConfigFile(file string, cfg any) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".json":
+		err = jsonEngine.Unmarshal(data, cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("svc: unsupported config file %s", file)
+	}
+	if err != nil {
+		return fmt.Errorf("svc: config file %s: %w", file, err)
+	}
+	return nil
+}
+
+// parseConfigFlags returns the values of the flags set in args
+func parseConfigFlags(args []string) (map[string]string, error) {
+	fs := flag.NewFlagSet("svc", flag.ContinueOnError)
+	fs.String("config", "", "config file")
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		if name := typ.Field(i).Tag.Get("flag"); name != "" {
+			fs.String(name, "", typ.Field(i).Name)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+	return flags, nil
+}
+
+func overrideConfig(cfg *Config, tag string, lookup func(key string) (string, bool)) error {
+	var errs []error
+	value := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get(tag)
+		if key == "" {
+			continue
+		}
+		str, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		if err := setConfigField(value.Field(i), str); err != nil {
+			errs = append(errs, fmt.Errorf("svc: config %s %s: %w", tag, key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setConfigField(field reflect.Value, str string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(str)
+	case bool:
+		if str == "" {
+			field.SetBool(false) // like the unset ENCRYPT_ENABLE and DECRYPT_ENABLE of old
+			return nil
+		}
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case []string:
+		var values []string
+		for _, s := range strings.Split(str, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	case Duration:
+		return field.Addr().Interface().(*Duration).UnmarshalText([]byte(str))
+	}
+	return nil
+}
+
+// Validate reports all the invalid settings of cfg
+func (cfg Config) Validate() error {
+	var problems []string
+	if (cfg.EncryptEnable || cfg.DecryptEnable || cfg.AesKey != "") && len(cfg.AesKey) != 16 {
+		problems = append(problems, fmt.Sprintf("aes_key must be 16 bytes, got %d", len(cfg.AesKey)))
+	}
+	for _, origin := range cfg.CorsOrigins {
+		if !validOrigin(origin) {
+			problems = append(problems, fmt.Sprintf("cors_origins %q is not * or scheme://host[:port]", origin))
+		}
+	}
+	for name, d := range map[string]Duration{
+		"read_timeout":        cfg.ReadTimeout,
+		"read_header_timeout": cfg.ReadHeaderTimeout,
+		"write_timeout":       cfg.WriteTimeout,
+		"idle_timeout":        cfg.IdleTimeout,
+	} {
+		if d < 0 {
+			problems = append(problems, name+" must not be negative")
+		}
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown_timeout must be positive")
+	}
+	if cfg.ReadTimeout > 0 && cfg.ReadHeaderTimeout > cfg.ReadTimeout {
+		problems = append(problems, "read_header_timeout must not exceed read_timeout")
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("svc: invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == ""
+}
+
+// ApplyConfig validates cfg, then applies the encryption and CORS origins of it to the Settings of app
+// and the timeouts to the defaults of Run
+func (app *App) ApplyConfig(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s := app.Settings()
+	s.EncryptEnable, s.DecryptEnable, s.AesKey, s.CorsOrigins = cfg.EncryptEnable, cfg.DecryptEnable, cfg.AesKey, cfg.CorsOrigins
+	if err := app.SetSettings(s); err != nil {
+		return err
+	}
+	app.config = &cfg
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigPartiallyInvalidEnv(t *testing.T) {
+	env := map[string]string{
+		"ENCRYPT_ENABLE": "yes",
+		"DECRYPT_ENABLE": "T",
+		"AES_KEY":        "0123456789abcdef",
+		"READ_TIMEOUT":   "soon",
+		"HTTP_ADDR":      ":9090",
+	}
+	cfg, err := LoadConfig(func(opt *ConfigOption) {
+		opt.LookupEnv = func(key string) (string, bool) { v, ok := env[key]; return v, ok }
+	})
+	if err == nil || !strings.Contains(err.Error(), "ENCRYPT_ENABLE") || !strings.Contains(err.Error(), "READ_TIMEOUT") {
+		t.Fatalf("want the errors of ENCRYPT_ENABLE and READ_TIMEOUT, got %v", err)
+	}
+	if cfg.EncryptEnable || !cfg.DecryptEnable || cfg.AesKey != env["AES_KEY"] || cfg.Addr != ":9090" {
+		t.Fatalf("the valid env after an invalid one is not loaded: %+v", cfg)
+	}
+	if cfg.ReadTimeout != DefaultConfig().ReadTimeout {
+		t.Fatalf("an invalid value changed its field: %v", cfg.ReadTimeout)
+	}
+
+	env = map[string]string{"ENCRYPT_ENABLE": "", "DECRYPT_ENABLE": "T", "AES_KEY": "0123456789abcdef"}
+	if cfg, err = LoadConfig(func(opt *ConfigOption) {
+		opt.LookupEnv = func(key string) (string, bool) { v, ok := env[key]; return v, ok }
+	}); err != nil || cfg.EncryptEnable || !cfg.DecryptEnable {
+		t.Fatalf("an empty ENCRYPT_ENABLE is false: %+v, %v", cfg, err)
+	}
+}
+
+func TestAesUsesSettingsKey(t *testing.T) {
+	old := defaultApp.snapshot()
+	t.Cleanup(func() {
+		if old != nil {
+			defaultApp.settings.Store(old)
+		} else {
+			defaultApp.settings.Store((*Settings)(nil))
+		}
+	})
+	const key = "fedcba9876543210"
+	if err := defaultApp.SetSettings(Settings{AesKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	cipherText, err := AesEncrypt([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := aesEncrypt(key, []byte("hello"))
+	if cipherText != want {
+		t.Fatal("AesEncrypt did not use the key of the settings")
+	}
+	if plainText, dErr := AesDecrypt([]byte(cipherText)); dErr != nil || string(plainText) != "hello" {
+		t.Fatalf("got %q, %v", plainText, dErr)
+	}
+}
@@ -1,8 +1,9 @@
 package svc
 
 import (
-	"fmt"
+	"errors"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -10,18 +11,23 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// encrypted reports whether header declares its body encrypted
+func encrypted(header http.Header) bool { return strings.EqualFold(header.Get("Encryption"), "Yes") }
+
 func Decryption() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		if DecryptEnable {
-			encryption := strings.EqualFold(ctx.Request.Header.Get("Encryption"), "Yes")
+		app := appOf(ctx)
+		if app.decryptEnabled() {
+			encryption := encrypted(ctx.Request.Header)
+			keyID := ctx.GetHeader(encryptionKeyIDHeader)
 			if encryption {
 				if ctx.Request.Method == http.MethodGet {
 					// decrypt query string
 					qs := ctx.Request.URL.Query()
 					if qs.Has("encryption_data") {
 						encryptionData := qs.Get("encryption_data")
-						if decryptBytes, err := AesDecrypt([]byte(encryptionData)); err != nil {
-							fmt.Println(err)
+						if decryptBytes, err := app.aesDecrypt(keyID, []byte(encryptionData)); err != nil {
+							slog.Warn("svc: decrypt request", "err", err)
 						} else {
 							qm, _ := url.ParseQuery(string(decryptBytes))
 							ctx.Set("have_encryption_data", "Yes")
@@ -32,10 +38,15 @@ func Decryption() gin.HandlerFunc {
 				} else {
 					// decrypt body
 					if readAllBytes, err := io.ReadAll(ctx.Request.Body); err != nil {
-						fmt.Println(err)
+						if err = tooLarge(err); errors.Is(err, ErrRequestTooLarge) {
+							ctx.Abort()
+							WriteJSON(ctx, http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "", err, nil)
+							return
+						}
+						slog.Warn("svc: decrypt request", "err", err)
 					} else {
-						if decryptBytes, dErr := AesDecrypt(readAllBytes); dErr != nil {
-							fmt.Println(dErr)
+						if decryptBytes, dErr := app.aesDecrypt(keyID, readAllBytes); dErr != nil {
+							slog.Warn("svc: decrypt request", "err", dErr)
 						} else {
 							ctx.Set("have_encryption_data", "Yes")
 							ctx.Set("encryption_data_type", "Body")
@@ -11,7 +11,10 @@
 
 package svc
 
-import "io"
+import (
+	"io"
+	"strings"
+)
 
 var (
 	ErrNoReturn = io.ErrNoProgress
@@ -37,3 +40,19 @@ func NewErrorWithCodes(error string, httpCode int, code int) *Error {
 }
 
 func (e *Error) Error() string { return e.error }
+
+// BindError reports the request fields failed to bind, written as the data of the bind error response
+type BindError struct{ Fields []FieldError }
+
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (e *BindError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Reason+" field "+f.Field)
+	}
+	return strings.Join(messages, "; ")
+}
@@ -12,12 +12,13 @@
 package svc
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 )
@@ -32,6 +33,20 @@ var (
 	errConvertToMapString = errors.New("can not convert to map of strings")
 )
 
+// collection formats of slice and array fields, set globally by FormCollectionFormat
+// or per field by the collection_format tag option, e.g. `form:"ids,collection_format=csv"`
+const (
+	CollectionMulti    = "multi"    // ids=1&ids=2
+	CollectionCSV      = "csv"      // ids=1,2
+	CollectionSSV      = "ssv"      // ids=1 2
+	CollectionPipes    = "pipes"    // ids=1|2
+	CollectionBrackets = "brackets" // ids[]=1&ids[]=2 or ids[0]=1&ids[1]=2
+)
+
+var defaultCollectionFormat = CollectionMulti
+
+func FormCollectionFormat(format string) { defaultCollectionFormat = format }
+
 func mapURI(ptr any, m map[string][]string) error {
 	return mapFormByTag(ptr, m, "uri")
 }
@@ -44,8 +59,6 @@ func MapFormWithTag(ptr any, form map[string][]string, tag string) error {
 	return mapFormByTag(ptr, form, tag)
 }
 
-var emptyField = reflect.StructField{}
-
 func mapFormByTag(ptr any, form map[string][]string, tag string) error {
 	// Check if ptr is a map
 	ptrVal := reflect.ValueOf(ptr)
@@ -80,25 +93,142 @@ func (form formSource) TrySet(value reflect.Value, field reflect.StructField, ta
 }
 
 func mappingByPtr(ptr any, setter setter, tag string) error {
-	_, err := mapping(reflect.ValueOf(ptr), emptyField, setter, tag)
+	_, err := mapping(reflect.ValueOf(ptr), setter, tag)
 	return err
 }
 
-func mapping(value reflect.Value, field reflect.StructField, setter setter, tag string) (bool, error) {
-	if field.Tag.Get(tag) == "-" { // just ignoring this field
+func mapping(value reflect.Value, setter setter, tag string) (bool, error) {
+	if value.Kind() == reflect.Ptr {
+		var isNew bool
+		vPtr := value
+		if value.IsNil() {
+			isNew = true
+			vPtr = reflect.New(value.Type().Elem())
+		}
+		isSet, err := mapping(vPtr.Elem(), setter, tag)
+		if err != nil {
+			return false, err
+		}
+		if isNew && isSet {
+			value.Set(vPtr)
+		}
+		return isSet, nil
+	}
+	if value.Kind() != reflect.Struct {
 		return false, nil
 	}
+	return cachedPlan(value.Type(), tag).bind(value, setter)
+}
+
+type (
+	planKey struct {
+		typ reflect.Type
+		tag string
+	}
 
-	vKind := value.Kind()
+	// structPlan is the compiled mapping of a struct type for a tag,
+	// so tags are parsed and setters are chosen once per type instead of per request
+	structPlan struct {
+		fields  []fieldPlan
+		streams bool                 // has FileStream fields
+		files   map[string]*fileRule // the file rules by form key, nested structs included
+	}
+
+	fieldPlan struct {
+		index  int
+		field  reflect.StructField
+		key    string // empty for embedded structs which are only walked into
+		opt    setOptions
+		nested *structPlan // set when the dereferenced field type is a struct
+	}
+)
+
+var plans sync.Map // planKey -> *structPlan
+
+func cachedPlan(typ reflect.Type, tag string) *structPlan {
+	if p, ok := plans.Load(planKey{typ, tag}); ok {
+		return p.(*structPlan)
+	}
+	return compilePlan(typ, tag, make(map[reflect.Type]*structPlan))
+}
+
+func compilePlan(typ reflect.Type, tag string, building map[reflect.Type]*structPlan) *structPlan {
+	if p, ok := plans.Load(planKey{typ, tag}); ok {
+		return p.(*structPlan)
+	}
+	if p, ok := building[typ]; ok { // self referencing types
+		return p
+	}
+	p := &structPlan{}
+	building[typ] = p
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous { // unexported
+			continue
+		}
+		tagValue := sf.Tag.Get(tag)
+		if tagValue == "-" { // just ignoring this field
+			continue
+		}
+		fp := fieldPlan{index: i, field: sf}
+		elem := sf.Type
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct || !sf.Anonymous {
+			fp.key, fp.opt = parseTag(sf, tagValue, tag)
+			fp.opt.set = compileSetFunc(elem)
+		}
+		if fp.opt.file != nil {
+			p.addFileRule(fp.key, fp.opt.file)
+		}
+		switch {
+		case elem == fileStreamType:
+			p.streams = true
+		case elem == fileHeaderType:
+		case elem.Kind() == reflect.Struct:
+			fp.nested = compilePlan(elem, tag, building)
+			p.streams = p.streams || fp.nested.streams
+			for key, rule := range fp.nested.files {
+				p.addFileRule(key, rule)
+			}
+		}
+		p.fields = append(p.fields, fp)
+	}
+	actual, _ := plans.LoadOrStore(planKey{typ, tag}, p)
+	return actual.(*structPlan)
+}
 
-	if vKind == reflect.Ptr {
+func (p *structPlan) addFileRule(key string, rule *fileRule) {
+	if p.files == nil {
+		p.files = make(map[string]*fileRule)
+	}
+	if _, ok := p.files[key]; !ok {
+		p.files[key] = rule
+	}
+}
+
+func (p *structPlan) bind(value reflect.Value, setter setter) (isSet bool, err error) {
+	for i := range p.fields {
+		fp := &p.fields[i]
+		ok, err := fp.bind(value.Field(fp.index), setter)
+		if err != nil {
+			return false, err
+		}
+		isSet = isSet || ok
+	}
+	return isSet, nil
+}
+
+func (fp *fieldPlan) bind(value reflect.Value, setter setter) (bool, error) {
+	if value.Kind() == reflect.Ptr {
 		var isNew bool
 		vPtr := value
 		if value.IsNil() {
 			isNew = true
 			vPtr = reflect.New(value.Type().Elem())
 		}
-		isSet, err := mapping(vPtr.Elem(), field, setter, tag)
+		isSet, err := fp.bind(vPtr.Elem(), setter)
 		if err != nil {
 			return false, err
 		}
@@ -107,9 +237,8 @@ func mapping(value reflect.Value, field reflect.StructField, setter setter, tag
 		}
 		return isSet, nil
 	}
-
-	if vKind != reflect.Struct || !field.Anonymous {
-		ok, err := tryToSetValue(value, field, setter, tag)
+	if fp.key != "" {
+		ok, err := setter.TrySet(value, fp.field, fp.key, fp.opt)
 		if err != nil {
 			return false, err
 		}
@@ -117,61 +246,217 @@ func mapping(value reflect.Value, field reflect.StructField, setter setter, tag
 			return true, nil
 		}
 	}
+	if fp.nested != nil {
+		return fp.nested.bind(value, setter)
+	}
+	return false, nil
+}
 
-	if vKind == reflect.Struct {
-		tValue := value.Type()
-
-		var isSet bool
-		for i := 0; i < value.NumField(); i++ {
-			sf := tValue.Field(i)
-			if sf.PkgPath != "" && !sf.Anonymous { // unexported
-				continue
+// target returns the type set by the raw form key, following bracketed keys
+// into nested structs, maps and slices like setByForm does
+func (p *structPlan) target(key, tag string) (reflect.Type, bool) {
+	seg, rest, nested := splitKey(key)
+	for i := range p.fields {
+		fp := &p.fields[i]
+		if fp.key != "" && fp.key == seg {
+			if typ, ok := targetOf(fp.field.Type, rest, nested, tag, fp.opt.format()); ok {
+				return typ, true
 			}
-			ok, err := mapping(value.Field(i), sf, setter, tag)
-			if err != nil {
-				return false, err
+		}
+		if fp.nested != nil {
+			if typ, ok := fp.nested.target(key, tag); ok {
+				return typ, true
 			}
-			isSet = isSet || ok
 		}
-		return isSet, nil
 	}
-	return false, nil
+	return nil, false
 }
 
-type setOptions struct {
-	isDefaultExists bool
-	defaultValue    string
+func targetOf(typ reflect.Type, rest string, nested bool, tag, format string) (reflect.Type, bool) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if !nested {
+		return typ, true
+	}
+	switch typ.Kind() {
+	case reflect.Struct:
+		if typ == timeType {
+			return nil, false
+		}
+		return cachedPlan(typ, tag).target(rest, tag)
+	case reflect.Map:
+		if seg, rest, nested := splitKey(rest); seg != "" {
+			return targetOf(typ.Elem(), rest, nested, tag, format)
+		}
+	case reflect.Slice, reflect.Array:
+		if format != CollectionBrackets {
+			return nil, false
+		}
+		seg, rest, nested := splitKey(rest)
+		if seg == "" && !nested {
+			return typ, true
+		}
+		if _, err := strconv.Atoi(seg); err == nil {
+			return targetOf(typ.Elem(), rest, nested, tag, format)
+		}
+	}
+	return nil, false
 }
 
-func tryToSetValue(value reflect.Value, field reflect.StructField, setter setter, tag string) (bool, error) {
-	var tagValue string
-	var setOpt setOptions
+// splitKey splits a[b][c] into a and b[c], nested reports whether the key was bracketed
+func splitKey(key string) (seg, rest string, nested bool) {
+	i := strings.IndexByte(key, '[')
+	if i < 0 {
+		return key, "", false
+	}
+	j := strings.IndexByte(key[i:], ']')
+	if j < 0 {
+		return key, "", false
+	}
+	return key[:i], key[i+1:i+j] + key[i+j+1:], true
+}
 
-	tagValue = field.Tag.Get(tag)
-	tagValue, opts := head(tagValue, ",")
+type (
+	setFunc func(val string, value reflect.Value, field reflect.StructField) error
 
-	if tagValue == "" { // default value is FieldName
-		tagValue = field.Name
+	setOptions struct {
+		isDefaultExists  bool
+		defaultValue     string
+		collectionFormat string
+		tag              string
+		set              setFunc // compiled for the field type, nil for dynamic values like map elements
+		file             *fileRule
 	}
-	if tagValue == "" { // when field is "emptyField" variable
-		return false, nil
+)
+
+func (opt setOptions) format() string {
+	if opt.collectionFormat != "" {
+		return opt.collectionFormat
+	}
+	return defaultCollectionFormat
+}
+
+func (opt setOptions) setValue(val string, value reflect.Value, field reflect.StructField) error {
+	if opt.set != nil {
+		return opt.set(val, value, field)
+	}
+	return setWithProperType(val, value, field)
+}
+
+func parseTag(field reflect.StructField, tagValue, tag string) (key string, setOpt setOptions) {
+	key, opts := head(tagValue, ",")
+	if key == "" { // default value is FieldName
+		key = field.Name
+	}
+	setOpt.tag = tag
+	if rule := field.Tag.Get("file"); rule != "" {
+		setOpt.file = parseFileRule(rule)
 	}
 
 	var opt string
 	for len(opts) > 0 {
 		opt, opts = head(opts, ",")
 
-		if k, v := head(opt, "="); k == "default" {
+		switch k, v := head(opt, "="); k {
+		case "default":
 			setOpt.isDefaultExists = true
 			setOpt.defaultValue = v
+		case "collection_format":
+			setOpt.collectionFormat = v
 		}
 	}
+	return
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
 
-	return setter.TrySet(value, field, tagValue, setOpt)
+// compileSetFunc chooses the setter of typ, or of its element for slices and arrays
+func compileSetFunc(typ reflect.Type) setFunc {
+	if kind := typ.Kind(); kind == reflect.Slice || kind == reflect.Array {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Int:
+		return intSetFunc(0)
+	case reflect.Int8:
+		return intSetFunc(8)
+	case reflect.Int16:
+		return intSetFunc(16)
+	case reflect.Int32:
+		return intSetFunc(32)
+	case reflect.Int64:
+		if typ == durationType {
+			return func(val string, value reflect.Value, _ reflect.StructField) error { return setTimeDuration(val, value) }
+		}
+		return intSetFunc(64)
+	case reflect.Uint:
+		return uintSetFunc(0)
+	case reflect.Uint8:
+		return uintSetFunc(8)
+	case reflect.Uint16:
+		return uintSetFunc(16)
+	case reflect.Uint32:
+		return uintSetFunc(32)
+	case reflect.Uint64:
+		return uintSetFunc(64)
+	case reflect.Bool:
+		return func(val string, value reflect.Value, _ reflect.StructField) error { return setBoolField(val, value) }
+	case reflect.Float32:
+		return floatSetFunc(32)
+	case reflect.Float64:
+		return floatSetFunc(64)
+	case reflect.String:
+		return func(val string, value reflect.Value, _ reflect.StructField) error { value.SetString(val); return nil }
+	case reflect.Struct:
+		if typ == timeType {
+			return func(val string, value reflect.Value, field reflect.StructField) error {
+				return setTimeField(val, field, value)
+			}
+		}
+		return setJSONValue
+	case reflect.Map:
+		return setJSONValue
+	default:
+		return func(string, reflect.Value, reflect.StructField) error { return errUnknownType }
+	}
+}
+
+func intSetFunc(bitSize int) setFunc {
+	return func(val string, value reflect.Value, _ reflect.StructField) error {
+		return setIntField(val, bitSize, value)
+	}
+}
+
+func uintSetFunc(bitSize int) setFunc {
+	return func(val string, value reflect.Value, _ reflect.StructField) error {
+		return setUintField(val, bitSize, value)
+	}
+}
+
+func floatSetFunc(bitSize int) setFunc {
+	return func(val string, value reflect.Value, _ reflect.StructField) error {
+		return setFloatField(val, bitSize, value)
+	}
+}
+
+func setJSONValue(val string, value reflect.Value, _ reflect.StructField) error {
+	return jsonEngine.Unmarshal(StringToBytes(val), value.Addr().Interface())
 }
 
 func setByForm(value reflect.Value, field reflect.StructField, form map[string][]string, tagValue string, opt setOptions) (isSet bool, err error) {
 	vs, ok := form[tagValue]
+	if !ok {
+		// filter[status]=open, ids[]=1 or items[0][name]=x
+		if sub := subForm(form, tagValue); len(sub) > 0 {
+			if isSet, err = setByBrackets(value, field, sub, opt); isSet || err != nil {
+				return
+			}
+		}
+	}
 	if !ok && !opt.isDefaultExists {
 		return false, nil
 	}
@@ -181,15 +466,16 @@ func setByForm(value reflect.Value, field reflect.StructField, form map[string][
 		if !ok {
 			vs = []string{opt.defaultValue}
 		}
-		return true, setSlice(vs, value, field)
+		return true, setSlice(splitCollection(vs, opt.format()), value, field, opt)
 	case reflect.Array:
 		if !ok {
 			vs = []string{opt.defaultValue}
 		}
+		vs = splitCollection(vs, opt.format())
 		if len(vs) != value.Len() {
 			return false, fmt.Errorf("%q is not valid value for %s", vs, value.Type().String())
 		}
-		return true, setArray(vs, value, field)
+		return true, setArray(vs, value, field, opt)
 	default:
 		var val string
 		if !ok {
@@ -199,8 +485,148 @@ func setByForm(value reflect.Value, field reflect.StructField, form map[string][
 		if len(vs) > 0 {
 			val = vs[0]
 		}
-		return true, setWithProperType(val, value, field)
+		return true, opt.setValue(val, value, field)
+	}
+}
+
+// splitCollection splits delimited values of csv, ssv and pipes collection formats
+func splitCollection(vs []string, format string) []string {
+	var sep string
+	switch format {
+	case CollectionCSV:
+		sep = ","
+	case CollectionSSV:
+		sep = " "
+	case CollectionPipes:
+		sep = "|"
+	default:
+		return vs
+	}
+	values := make([]string, 0, len(vs))
+	for _, v := range vs {
+		values = append(values, strings.Split(v, sep)...)
+	}
+	return values
+}
+
+// subForm returns the bracketed keys under prefix following the qs/Rails conventions,
+// e.g. filter[status]=open gives status=open and a[b][c]=x with prefix a gives b[c]=x
+func subForm(form map[string][]string, prefix string) map[string][]string {
+	var sub map[string][]string
+	for k, vs := range form {
+		if len(k) <= len(prefix)+1 || k[len(prefix)] != '[' || k[:len(prefix)] != prefix {
+			continue
+		}
+		rest := k[len(prefix)+1:]
+		idx := strings.IndexByte(rest, ']')
+		if idx < 0 {
+			continue
+		}
+		if sub == nil {
+			sub = make(map[string][]string)
+		}
+		key := rest[:idx] + rest[idx+1:]
+		sub[key] = append(sub[key], vs...)
+	}
+	return sub
+}
+
+// bracketKeys returns the sorted distinct first segments of the sub form keys, the empty segment of ids[] excluded
+func bracketKeys(sub map[string][]string) []string {
+	seen := make(map[string]struct{}, len(sub))
+	keys := make([]string, 0, len(sub))
+	for k := range sub {
+		if idx := strings.IndexByte(k, '['); idx >= 0 {
+			k = k[:idx]
+		}
+		if _, ok := seen[k]; ok || k == "" {
+			continue
+		}
+		seen[k] = struct{}{}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func setByBrackets(value reflect.Value, field reflect.StructField, sub map[string][]string, opt setOptions) (bool, error) {
+	switch value.Kind() {
+	case reflect.Struct:
+		if _, ok := value.Interface().(time.Time); ok {
+			return false, nil
+		}
+		return mapping(value, formSource(sub), opt.tag)
+	case reflect.Map:
+		return true, setMapByBrackets(value, field, sub, opt)
+	case reflect.Slice, reflect.Array:
+		if opt.format() != CollectionBrackets {
+			return false, nil
+		}
+		return true, setSliceByBrackets(value, field, sub, opt)
 	}
+	return false, nil
+}
+
+func setMapByBrackets(value reflect.Value, field reflect.StructField, sub map[string][]string, opt setOptions) error {
+	typ := value.Type()
+	if typ.Key().Kind() != reflect.String {
+		return errUnknownType
+	}
+	if value.IsNil() {
+		value.Set(reflect.MakeMap(typ))
+	}
+	opt.set = nil // compiled for the map itself
+	for _, key := range bracketKeys(sub) {
+		elem := reflect.New(typ.Elem()).Elem()
+		target := elem
+		if elem.Kind() == reflect.Ptr {
+			elem.Set(reflect.New(typ.Elem().Elem()))
+			target = elem.Elem()
+		}
+		if _, err := setByForm(target, field, sub, key, opt); err != nil {
+			return err
+		}
+		value.SetMapIndex(reflect.ValueOf(key).Convert(typ.Key()), elem)
+	}
+	return nil
+}
+
+// setSliceByBrackets sets ids[]=1 values first and then ids[0]=1 values ordered by index,
+// sparse indexes are compacted like qs does
+func setSliceByBrackets(value reflect.Value, field reflect.StructField, sub map[string][]string, opt setOptions) error {
+	vs := sub[""]
+	keys := bracketKeys(sub)
+	indexes := make(map[string]int, len(keys))
+	for _, key := range keys {
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 0 {
+			return fmt.Errorf("%q is not valid index for %s", key, value.Type().String())
+		}
+		indexes[key] = idx
+	}
+	sort.Slice(keys, func(i, j int) bool { return indexes[keys[i]] < indexes[keys[j]] })
+
+	n := len(vs) + len(keys)
+	slice := value
+	if value.Kind() == reflect.Array {
+		if n != value.Len() {
+			return fmt.Errorf("%d values is not valid for %s", n, value.Type().String())
+		}
+	} else {
+		slice = reflect.MakeSlice(value.Type(), n, n)
+	}
+	if err := setArray(vs, slice, field, opt); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if _, err := setByForm(slice.Index(len(vs)+i), field, sub, key, opt); err != nil {
+			return err
+		}
+	}
+	if value.Kind() == reflect.Slice {
+		value.Set(slice)
+	}
+	return nil
 }
 
 func setWithProperType(val string, value reflect.Value, field reflect.StructField) error {
@@ -242,9 +668,9 @@ func setWithProperType(val string, value reflect.Value, field reflect.StructFiel
 		case time.Time:
 			return setTimeField(val, field, value)
 		}
-		return json.Unmarshal(StringToBytes(val), value.Addr().Interface())
+		return jsonEngine.Unmarshal(StringToBytes(val), value.Addr().Interface())
 	case reflect.Map:
-		return json.Unmarshal(StringToBytes(val), value.Addr().Interface())
+		return jsonEngine.Unmarshal(StringToBytes(val), value.Addr().Interface())
 	default:
 		return errUnknownType
 	}
@@ -345,9 +771,9 @@ func setTimeField(val string, structField reflect.StructField, value reflect.Val
 	return nil
 }
 
-func setArray(vals []string, value reflect.Value, field reflect.StructField) error {
+func setArray(vals []string, value reflect.Value, field reflect.StructField, opt setOptions) error {
 	for i, s := range vals {
-		err := setWithProperType(s, value.Index(i), field)
+		err := opt.setValue(s, value.Index(i), field)
 		if err != nil {
 			return err
 		}
@@ -355,9 +781,9 @@ func setArray(vals []string, value reflect.Value, field reflect.StructField) err
 	return nil
 }
 
-func setSlice(vals []string, value reflect.Value, field reflect.StructField) error {
+func setSlice(vals []string, value reflect.Value, field reflect.StructField, opt setOptions) error {
 	slice := reflect.MakeSlice(value.Type(), len(vals), len(vals))
-	err := setArray(vals, slice, field)
+	err := setArray(vals, slice, field, opt)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,284 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrRequestTooLarge = NewErrorWithCodes("request body too large", http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge)
+	ErrTimeout         = NewErrorWithCodes("timeout", http.StatusGatewayTimeout, http.StatusGatewayTimeout)
+	ErrOverloaded      = NewErrorWithCodes("overloaded", http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+)
+
+// MaxBodySize rejects the request bodies over limit bytes with 413, use it before Decryption
+// to bound the bodies it reads
+func MaxBodySize(limit int64, encrypts ...bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.ContentLength > limit {
+			ctx.Abort()
+			WriteJSON(ctx, http.StatusRequestEntityTooLarge, http.StatusRequestEntityTooLarge, "", ErrRequestTooLarge, nil, encrypts...)
+			return
+		}
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		}
+		ctx.Next()
+	}
+}
+
+// tooLarge maps the read errors of the bodies over MaxBodySize to ErrRequestTooLarge
+func tooLarge(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return ErrRequestTooLarge
+	}
+	return err
+}
+
+// Timeout answers 504 once the routes using it run over timeout, even when their handlers ignore the deadline
+// of ctx.Request.Context(), which HttpDoCtx honors. The handlers write to a buffer sent
+// when they finish in time and discarded otherwise, so the streaming, SSE and WebSocket routes must not use it.
+// The 504 closes the connection, which is held until the handlers return
+func Timeout(timeout time.Duration, encrypts ...bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		writer := ctx.Writer
+		tw := newTimeoutWriter(writer)
+		expiredCtx := ctx.Copy() // renders the 504 while the handlers still own ctx
+		expiredCtx.Writer = newTimeoutWriter(writer)
+		ctx.Writer = tw
+		done := make(chan struct{})
+		var panicked any
+		go func() {
+			defer close(done)
+			defer func() { panicked = recover() }()
+			ctx.Next()
+		}()
+		select {
+		case <-done:
+		case <-reqCtx.Done():
+			select {
+			case <-done:
+			default:
+				if errors.Is(reqCtx.Err(), context.DeadlineExceeded) {
+					tw.expire()
+					expiredCtx.Header("Connection", "close") // the handlers still hold the connection
+					WriteJSON(expiredCtx, http.StatusGatewayTimeout, http.StatusGatewayTimeout, "", ErrTimeout, nil, encrypts...)
+					expiredCtx.Writer.(*timeoutWriter).flush()
+					writer.Flush() // the client gets the 504 now, not when the handlers return
+				}
+				<-done // gin reuses ctx after the middleware returns
+			}
+		}
+		ctx.Writer = writer
+		if tw.expired {
+			// the middlewares before Timeout, like AccessLog, Metrics and Tracing, record the 504
+			for _, key := range []string{respCodeKey, respErrorKey, respBodyKey} {
+				if value, ok := expiredCtx.Get(key); ok {
+					ctx.Set(key, value)
+				}
+			}
+			if panicked != nil {
+				slog.Error("svc: panic after timeout", "panic", panicked)
+			}
+			return
+		}
+		if panicked != nil {
+			panic(panicked)
+		}
+		tw.flush()
+	}
+}
+
+// timeoutWriter buffers the response of a Timeout route, discarding the writes after it expires
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu      sync.Mutex
+	header  http.Header
+	buf     bytes.Buffer
+	code    int
+	written bool
+	expired bool
+}
+
+func newTimeoutWriter(w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, header: w.Header().Clone(), code: http.StatusOK}
+}
+
+var errHijackTimeout = errors.New("svc: Timeout routes can not hijack the connection")
+
+func (w *timeoutWriter) Header() http.Header { return w.header }
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.written && code > 0 {
+		w.code = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.written = true
+	return w.buf.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) { return w.Write([]byte(s)) }
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.code
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.written {
+		return -1
+	}
+	return w.buf.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+func (w *timeoutWriter) Flush() {}
+
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errHijackTimeout
+}
+
+// expire discards the writes after it
+func (w *timeoutWriter) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expired = true
+}
+
+// flush sends the buffered response through the writer of the route
+func (w *timeoutWriter) flush() {
+	dst := w.ResponseWriter.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	if w.buf.Len() > 0 && dst.Get("Content-Length") == "" {
+		dst.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.written {
+		w.ResponseWriter.WriteHeaderNow()
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+}
+
+// timedOut maps the deadline errors of then-funcs on expired requests to ErrTimeout
+func timedOut(ctx *gin.Context, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Request.Context().Err() != nil {
+		return ErrTimeout
+	}
+	return err
+}
+
+type ConcurrencyOption struct {
+	MaxInFlight  int           // must be positive
+	MaxQueue     int           // of the requests waiting for a slot, the others are shed at once, 0 queues none
+	QueueTimeout time.Duration // of waiting for a slot, 0 waits until the request is done
+	Encrypt      bool          // encrypts the 503 responses
+}
+
+// ConcurrencyLimit caps the in-flight requests of the routes using it, queueing at most MaxQueue of
+// the others and shedding the rest with 503 and Retry-After, it panics on a MaxInFlight not positive
+// or a negative MaxQueue
+func ConcurrencyLimit(configure ...func(opt *ConcurrencyOption)) gin.HandlerFunc {
+	opt := ConcurrencyOption{MaxInFlight: 100, MaxQueue: 100, QueueTimeout: time.Second}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	if opt.MaxInFlight <= 0 || opt.MaxQueue < 0 {
+		panic(fmt.Sprintf("svc: ConcurrencyLimit needs a positive MaxInFlight and a non negative MaxQueue, got %d and %d", opt.MaxInFlight, opt.MaxQueue))
+	}
+	slots := make(chan struct{}, opt.MaxInFlight)
+	var queued int64
+	shed := func(ctx *gin.Context) {
+		ctx.Header("Retry-After", "1")
+		ctx.Abort()
+		WriteJSON(ctx, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "", ErrOverloaded, nil, opt.Encrypt)
+	}
+	return func(ctx *gin.Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			if atomic.AddInt64(&queued, 1) > int64(opt.MaxQueue) {
+				atomic.AddInt64(&queued, -1)
+				shed(ctx)
+				return
+			}
+			var timeout <-chan time.Time
+			if opt.QueueTimeout > 0 {
+				timer := time.NewTimer(opt.QueueTimeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			select {
+			case slots <- struct{}{}:
+				atomic.AddInt64(&queued, -1)
+			case <-timeout:
+				atomic.AddInt64(&queued, -1)
+				shed(ctx)
+				return
+			case <-ctx.Request.Context().Done():
+				// the client is gone, the 503 is for the logs and metrics
+				atomic.AddInt64(&queued, -1)
+				shed(ctx)
+				return
+			}
+		}
+		defer func() { <-slots }()
+		ctx.Next()
+	}
+}
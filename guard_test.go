@@ -0,0 +1,188 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeoutAnswersAtDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	release := make(chan struct{})
+	app := New()
+	app.GET("/slow", Timeout(50*time.Millisecond), func(ctx *gin.Context) {
+		<-release // ignores the deadline
+		ctx.String(http.StatusOK, "late")
+	})
+	app.GET("/fast", Timeout(time.Second), func(ctx *gin.Context) {
+		ctx.Header("X-Handler", "yes")
+		ctx.String(http.StatusCreated, "fast")
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+	defer close(release)
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout || string(body) != `{"code":504,"msg":"timeout"}` {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the 504 took %s", elapsed)
+	}
+
+	resp, err = http.Get(srv.URL + "/fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || string(body) != "fast" || resp.Header.Get("X-Handler") != "yes" {
+		t.Fatalf("got %d %s %v", resp.StatusCode, body, resp.Header)
+	}
+}
+
+func TestTimeoutRecordsResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	var code any
+	var msg string
+	app.Use(func(ctx *gin.Context) {
+		ctx.Next()
+		code, msg = ctx.Value(respCodeKey), ctx.GetString(respErrorKey)
+	})
+	app.GET("/slow", Timeout(20*time.Millisecond), func(ctx *gin.Context) {
+		<-ctx.Request.Context().Done()
+		time.Sleep(10 * time.Millisecond) // returns after the 504
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout || code != http.StatusGatewayTimeout || msg != ErrTimeout.Error() {
+		t.Fatalf("got %d, recorded code %v and error %q", w.Code, code, msg)
+	}
+}
+
+func TestTimeoutRepanics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	app.Use(gin.Recovery())
+	app.GET("/panic", Timeout(time.Second), func(ctx *gin.Context) { panic("boom") })
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d", w.Code)
+	}
+}
+
+// newLimitedApp serves /work blocking until release is closed, started receives a value per request in it
+func newLimitedApp(configure func(opt *ConcurrencyOption)) (app *App, started chan struct{}, release chan struct{}) {
+	gin.SetMode(gin.TestMode)
+	started, release = make(chan struct{}, 10), make(chan struct{})
+	app = New()
+	app.GET("/work", ConcurrencyLimit(configure), func(ctx *gin.Context) {
+		started <- struct{}{}
+		<-release
+		ctx.String(http.StatusOK, "done")
+	})
+	return
+}
+
+func serveAsync(app *App, req *http.Request) <-chan *httptest.ResponseRecorder {
+	ch := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		ch <- w
+	}()
+	return ch
+}
+
+func TestConcurrencyLimitQueuesAndSheds(t *testing.T) {
+	app, started, release := newLimitedApp(func(opt *ConcurrencyOption) {
+		opt.MaxInFlight, opt.MaxQueue, opt.QueueTimeout = 1, 1, 5*time.Second
+	})
+	first := serveAsync(app, httptest.NewRequest(http.MethodGet, "/work", nil))
+	<-started
+	queued := serveAsync(app, httptest.NewRequest(http.MethodGet, "/work", nil))
+	time.Sleep(50 * time.Millisecond) // lets the second request queue up
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("the request over the queue got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	for _, ch := range []<-chan *httptest.ResponseRecorder{first, queued} {
+		if w = <-ch; w.Code != http.StatusOK || w.Body.String() != "done" {
+			t.Fatalf("got %d %s", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	app, started, release := newLimitedApp(func(opt *ConcurrencyOption) {
+		opt.MaxInFlight, opt.MaxQueue, opt.QueueTimeout = 1, 1, 20*time.Millisecond
+	})
+	defer close(release)
+	_ = serveAsync(app, httptest.NewRequest(http.MethodGet, "/work", nil))
+	<-started
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("got %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestConcurrencyLimitClientGone(t *testing.T) {
+	app, started, release := newLimitedApp(func(opt *ConcurrencyOption) {
+		opt.MaxInFlight, opt.MaxQueue, opt.QueueTimeout = 1, 1, 0
+	})
+	defer close(release)
+	_ = serveAsync(app, httptest.NewRequest(http.MethodGet, "/work", nil))
+	<-started
+	reqCtx, cancel := context.WithCancel(context.Background())
+	queued := serveAsync(app, httptest.NewRequest(http.MethodGet, "/work", nil).WithContext(reqCtx))
+	cancel()
+	if w := <-queued; w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d", w.Code)
+	}
+}
+
+func TestConcurrencyLimitValidates(t *testing.T) {
+	for _, configure := range []func(opt *ConcurrencyOption){
+		func(opt *ConcurrencyOption) { opt.MaxInFlight = 0 },
+		func(opt *ConcurrencyOption) { opt.MaxInFlight = -1 },
+		func(opt *ConcurrencyOption) { opt.MaxQueue = -1 },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("ConcurrencyLimit accepted an invalid option")
+				}
+			}()
+			ConcurrencyLimit(configure)
+		}()
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// HealthChecker checks a dependency of the App for readiness
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) (err error)
+}
+
+type HealthCheckerFunc func(ctx context.Context) (err error)
+
+func (f HealthCheckerFunc) HealthCheck(ctx context.Context) error { return f(ctx) }
+
+// GormChecker pings the database of db
+func GormChecker(db *gorm.DB) HealthChecker {
+	return HealthCheckerFunc(func(ctx context.Context) (err error) {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return
+		}
+		return sqlDB.PingContext(ctx)
+	})
+}
+
+type (
+	HealthOption struct {
+		LivenessPath  string
+		ReadinessPath string
+		Timeout       time.Duration // of the checks without their own
+		CacheTTL      time.Duration // of the checks without their own, 0 checks on every request
+		Checks        []HealthCheck
+	}
+
+	HealthCheck struct {
+		Name     string
+		Checker  HealthChecker
+		Timeout  time.Duration
+		CacheTTL time.Duration
+	}
+
+	HealthResult struct {
+		Name   string `json:"name" xml:"name" yaml:"name"`
+		Status string `json:"status" xml:"status" yaml:"status"`
+		Error  string `json:"error,omitempty" xml:"error,omitempty" yaml:"error,omitempty"`
+	}
+)
+
+var errHealthTimeout = errors.New("timeout")
+
+// Health registers the liveness endpoint, always up while the process serves,
+// and the readiness endpoint, down when any check fails or the App is shutting down
+func (app *App) Health(configure ...func(opt *HealthOption)) {
+	opt := HealthOption{LivenessPath: "/healthz", ReadinessPath: "/readyz", Timeout: time.Second}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	checks := make([]*cachedCheck, 0, len(opt.Checks))
+	for _, check := range opt.Checks {
+		if check.Timeout <= 0 {
+			check.Timeout = opt.Timeout
+		}
+		if check.CacheTTL <= 0 {
+			check.CacheTTL = opt.CacheTTL
+		}
+		checks = append(checks, &cachedCheck{HealthCheck: check})
+	}
+	app.GET(opt.LivenessPath, func(ctx *gin.Context) { WriteMessageJSON(ctx, http.StatusOK, "up") })
+	app.GET(opt.ReadinessPath, func(ctx *gin.Context) {
+		if app.stopping() {
+			WriteMessageJSON(ctx, http.StatusServiceUnavailable, "shutting down")
+			return
+		}
+		results := make([]HealthResult, len(checks))
+		var wg sync.WaitGroup
+		for i, check := range checks {
+			wg.Add(1)
+			go func(i int, check *cachedCheck) {
+				defer wg.Done()
+				results[i] = check.result(ctx.Request.Context())
+			}(i, check)
+		}
+		wg.Wait()
+		httpCode, msg := http.StatusOK, "up"
+		for _, result := range results {
+			if result.Error != "" {
+				httpCode, msg = http.StatusServiceUnavailable, "down"
+			}
+		}
+		WriteJSON(ctx, httpCode, httpCode, msg, nil, results)
+	})
+}
+
+type cachedCheck struct {
+	HealthCheck
+	mu        sync.Mutex
+	last      HealthResult
+	checkedAt time.Time
+}
+
+func (c *cachedCheck) result(ctx context.Context) HealthResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.CacheTTL > 0 && !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.CacheTTL {
+		return c.last
+	}
+	c.last = HealthResult{Name: c.Name, Status: "up"}
+	if err := c.run(ctx); err != nil {
+		c.last.Status, c.last.Error = "down", err.Error()
+	}
+	c.checkedAt = time.Now()
+	return c.last
+}
+
+// run waits the check at most Timeout, even when the checker ignores ctx
+func (c *cachedCheck) run(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- c.Checker.HealthCheck(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errHealthTimeout
+	}
+}
@@ -13,13 +13,16 @@ package svc
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"io"
 	"net/http"
 	"reflect"
-	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type HttpResponse[T any] struct {
@@ -31,6 +34,11 @@ type HttpResponse[T any] struct {
 }
 
 func HttpDo[REQ, RESP any](method, url string, header map[string]string, req REQ, options ...func(client *http.Client)) (resp0 HttpResponse[RESP], resp RESP, err error) {
+	return HttpDoCtx[REQ, RESP](context.Background(), method, url, header, req, options...)
+}
+
+// HttpDoCtx is HttpDo bound to ctx, forwarding the request id carried by ctx
+func HttpDoCtx[REQ, RESP any](ctx context.Context, method, url string, header map[string]string, req REQ, options ...func(client *http.Client)) (resp0 HttpResponse[RESP], resp RESP, err error) {
 	if header == nil {
 		header = make(map[string]string)
 	}
@@ -42,12 +50,12 @@ func HttpDo[REQ, RESP any](method, url string, header map[string]string, req REQ
 		buf     []byte
 	)
 	if reflect.ValueOf(req).IsValid() {
-		if buf, err = json.Marshal(req); err != nil {
+		if buf, err = jsonEngine.Marshal(req); err != nil {
 			return
 		}
 		var encryptStr string
-		if EncryptEnable {
-			if encryptStr, err = AesEncrypt(buf); err != nil {
+		if app := appOfContext(ctx); app.encryptEnabled() {
+			if encryptStr, err = app.aesEncrypt(buf); err != nil {
 				return
 			}
 			by = bytes.NewBufferString(encryptStr)
@@ -56,7 +64,7 @@ func HttpDo[REQ, RESP any](method, url string, header map[string]string, req REQ
 			by = bytes.NewBuffer(buf)
 		}
 	}
-	if req0, err = http.NewRequest(method, url, by); err != nil {
+	if req0, err = http.NewRequestWithContext(requestContext(ctx), method, url, by); err != nil {
 		return
 	}
 	if header != nil {
@@ -64,6 +72,21 @@ func HttpDo[REQ, RESP any](method, url string, header map[string]string, req REQ
 			req0.Header.Set(k, v)
 		}
 	}
+	if id := RequestIDOf(ctx); id != "" && req0.Header.Get(RequestIDHeader) == "" {
+		req0.Header.Set(RequestIDHeader, id)
+	}
+	var span trace.Span
+	req0, span = traceClient(requestContext(ctx), req0)
+	defer func() {
+		if rawResp != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", rawResp.StatusCode))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 	client := &http.Client{Timeout: time.Second * 10}
 	if len(options) > 0 {
 		for _, opt := range options {
@@ -72,7 +95,10 @@ func HttpDo[REQ, RESP any](method, url string, header map[string]string, req REQ
 			}
 		}
 	}
-	if rawResp, err = client.Do(req0); err != nil {
+	start := time.Now()
+	rawResp, err = client.Do(req0)
+	appOfContext(ctx).observeClient(req0, rawResp, start)
+	if err != nil {
 		return
 	}
 	var bodyBuf []byte
@@ -83,12 +109,12 @@ func HttpDo[REQ, RESP any](method, url string, header map[string]string, req REQ
 		err = errors.New("response body is empty")
 		return
 	}
-	if encryption := strings.EqualFold(rawResp.Header.Get("Encryption"), "Yes"); encryption && DecryptEnable {
-		if bodyBuf, err = AesDecrypt(bodyBuf); err != nil {
+	if app := appOfContext(ctx); encrypted(rawResp.Header) && app.decryptEnabled() {
+		if bodyBuf, err = app.aesDecrypt(rawResp.Header.Get(encryptionKeyIDHeader), bodyBuf); err != nil {
 			return
 		}
 	}
-	if err = json.Unmarshal(bodyBuf, &resp0); err != nil {
+	if err = jsonEngine.Unmarshal(bodyBuf, &resp0); err != nil {
 		return
 	}
 	resp0.rawResponse = rawResp
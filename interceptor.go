@@ -0,0 +1,67 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+type (
+	// Handler is the then-func as seen by interceptors, req and resp hold the typed REQ and RESP values
+	Handler func(ctx *gin.Context, req any) (resp any, err error)
+
+	// Interceptor wraps the then-func, it may inspect or replace req and resp,
+	// or short-circuit by returning without calling next
+	Interceptor func(ctx *gin.Context, req any, next Handler) (resp any, err error)
+)
+
+const interceptorsKey = "svc_interceptors"
+
+// Intercept registers interceptors for the engine or route group using it,
+// the interceptors registered first are the outermost
+func Intercept(interceptors ...Interceptor) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		chain := interceptorsOf(ctx)
+		ctx.Set(interceptorsKey, append(chain[:len(chain):len(chain)], interceptors...))
+		ctx.Next()
+	}
+}
+
+func interceptorsOf(ctx *gin.Context) []Interceptor {
+	if value, ok := ctx.Get(interceptorsKey); ok {
+		if interceptors, okk := value.([]Interceptor); okk {
+			return interceptors
+		}
+	}
+	return nil
+}
+
+func invoke[REQ, RESP any](ctx *gin.Context, req REQ, thenFunc thenFunc[REQ, RESP]) (resp any, err error) {
+	interceptors := interceptorsOf(ctx)
+	if len(interceptors) == 0 {
+		return thenFunc(req)
+	}
+	handler := Handler(func(ctx *gin.Context, req any) (resp any, err error) {
+		r, ok := req.(REQ)
+		if !ok {
+			return nil, fmt.Errorf("svc: interceptor passed req of %T, want %T", req, r)
+		}
+		return thenFunc(r)
+	})
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx *gin.Context, req any) (resp any, err error) { return interceptor(ctx, req, next) }
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+type (
+	// JSONCodec is the JSON engine all svc serialization goes through,
+	// chosen like gin by the jsoniter, go_json or sonic build tags, or replaced by SetJSONCodec
+	JSONCodec interface {
+		Marshal(v any) ([]byte, error)
+		Unmarshal(data []byte, v any) error
+		NewDecoder(r io.Reader) JSONDecoder
+		NewEncoder(w io.Writer) JSONEncoder
+	}
+
+	JSONDecoder interface {
+		Decode(v any) error
+		DisallowUnknownFields()
+		UseNumber()
+	}
+
+	JSONEncoder interface {
+		Encode(v any) error
+		SetEscapeHTML(on bool)
+		SetIndent(prefix, indent string)
+	}
+)
+
+var jsonEngine = defaultJSONCodec
+
+func SetJSONCodec(codec JSONCodec) { jsonEngine = codec }
+
+func GetJSONCodec() JSONCodec { return jsonEngine }
+
+// decodeJSON decodes like gin's JSON binding, honoring binding.EnableDecoderUseNumber
+// and binding.EnableDecoderDisallowUnknownFields, strict rejects the unknown fields as *BindError
+func decodeJSON(r io.Reader, ptr any, strict bool) error {
+	if r == nil {
+		return errors.New("invalid request")
+	}
+	if strict {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err = checkStrictJSON(data, ptr); err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	decoder := jsonEngine.NewDecoder(r)
+	if binding.EnableDecoderUseNumber {
+		decoder.UseNumber()
+	}
+	if binding.EnableDecoderDisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(ptr)
+}
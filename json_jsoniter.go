@@ -0,0 +1,31 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build jsoniter
+
+package svc
+
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+var defaultJSONCodec JSONCodec = jsoniterJSON{}
+
+type jsoniterJSON struct{}
+
+var jsoniterAPI = jsoniter.ConfigCompatibleWithStandardLibrary
+
+func (jsoniterJSON) Marshal(v any) ([]byte, error)      { return jsoniterAPI.Marshal(v) }
+func (jsoniterJSON) Unmarshal(data []byte, v any) error { return jsoniterAPI.Unmarshal(data, v) }
+func (jsoniterJSON) NewDecoder(r io.Reader) JSONDecoder { return jsoniterAPI.NewDecoder(r) }
+func (jsoniterJSON) NewEncoder(w io.Writer) JSONEncoder { return jsoniterAPI.NewEncoder(w) }
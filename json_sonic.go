@@ -0,0 +1,29 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build sonic && avx && (linux || windows || darwin) && amd64
+
+package svc
+
+import (
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+var defaultJSONCodec JSONCodec = sonicJSON{}
+
+type sonicJSON struct{}
+
+func (sonicJSON) Marshal(v any) ([]byte, error)      { return sonic.ConfigStd.Marshal(v) }
+func (sonicJSON) Unmarshal(data []byte, v any) error { return sonic.ConfigStd.Unmarshal(data, v) }
+func (sonicJSON) NewDecoder(r io.Reader) JSONDecoder { return sonic.ConfigStd.NewDecoder(r) }
+func (sonicJSON) NewEncoder(w io.Writer) JSONEncoder { return sonic.ConfigStd.NewEncoder(w) }
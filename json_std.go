@@ -0,0 +1,28 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !jsoniter && !go_json && !(sonic && avx && (linux || windows || darwin) && amd64)
+
+package svc
+
+import (
+	"encoding/json"
+	"io"
+)
+
+var defaultJSONCodec JSONCodec = stdJSON{}
+
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (stdJSON) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (stdJSON) NewDecoder(r io.Reader) JSONDecoder { return json.NewDecoder(r) }
+func (stdJSON) NewEncoder(w io.Writer) JSONEncoder { return json.NewEncoder(w) }
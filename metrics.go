@@ -0,0 +1,271 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsRegistry records the metrics of svc and serves them, labels are name and value pairs
+type MetricsRegistry interface {
+	Inc(name string, labels ...string)
+	Observe(name string, value float64, labels ...string)
+	http.Handler
+}
+
+const (
+	metricRequests        = "svc_http_requests_total"
+	metricRequestDuration = "svc_http_request_duration_seconds"
+	metricBusinessErrors  = "svc_business_errors_total"
+	metricStageFailures   = "svc_stage_failures_total"
+	metricCrypto          = "svc_crypto_operations_total"
+	metricCryptoDuration  = "svc_crypto_duration_seconds"
+	metricClientRequests  = "svc_http_client_requests_total"
+	metricClientDuration  = "svc_http_client_request_duration_seconds"
+)
+
+var metricHelp = map[string]string{
+	metricRequests:        "HTTP requests by route, method and status.",
+	metricRequestDuration: "HTTP request latency by route, method and status.",
+	metricBusinessErrors:  "Error responses by route and business code.",
+	metricStageFailures:   "Requests failed by route and stage of bind, validate or check.",
+	metricCrypto:          "AES operations by op and result.",
+	metricCryptoDuration:  "AES operation latency by op.",
+	metricClientRequests:  "HttpDo requests by method, host and status.",
+	metricClientDuration:  "HttpDo request latency by method and host.",
+}
+
+type MetricsOption struct {
+	Path     string
+	Registry MetricsRegistry
+}
+
+// Metrics records the metrics of the routes registered after it into Registry and serves them on Path
+func (app *App) Metrics(configure ...func(opt *MetricsOption)) {
+	opt := MetricsOption{Path: "/metrics"}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	if opt.Registry == nil {
+		opt.Registry = NewPromRegistry()
+	}
+	app.metrics = opt.Registry
+	app.GET(opt.Path, gin.WrapH(opt.Registry))
+	app.Use(func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+		route, method, status := routeOf(ctx), ctx.Request.Method, strconv.Itoa(ctx.Writer.Status())
+		app.metrics.Inc(metricRequests, "route", route, "method", method, "status", status)
+		app.metrics.Observe(metricRequestDuration, time.Since(start).Seconds(), "route", route, "method", method, "status", status)
+		if ctx.GetString(respErrorKey) != "" {
+			app.metrics.Inc(metricBusinessErrors, "route", route, "code", fmt.Sprint(ctx.Value(respCodeKey)))
+		}
+	})
+}
+
+func routeOf(ctx *gin.Context) string {
+	if route := ctx.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+func (app *App) observeStageFailure(ctx *gin.Context, stage string) {
+	if app.metrics != nil {
+		app.metrics.Inc(metricStageFailures, "route", routeOf(ctx), "stage", stage)
+	}
+}
+
+func (app *App) observeCrypto(op string, start time.Time, err *error) {
+	if app.metrics == nil {
+		return
+	}
+	result := "ok"
+	if *err != nil {
+		result = "error"
+	}
+	app.metrics.Inc(metricCrypto, "op", op, "result", result)
+	app.metrics.Observe(metricCryptoDuration, time.Since(start).Seconds(), "op", op)
+}
+
+func (app *App) observeClient(req *http.Request, resp *http.Response, start time.Time) {
+	if app.metrics == nil {
+		return
+	}
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	app.metrics.Inc(metricClientRequests, "method", req.Method, "host", req.URL.Host, "status", status)
+	app.metrics.Observe(metricClientDuration, time.Since(start).Seconds(), "method", req.Method, "host", req.URL.Host)
+}
+
+// PromRegistry is the MetricsRegistry writing the Prometheus text format
+type PromRegistry struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// DefaultBuckets are the latency buckets in seconds of NewPromRegistry
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewPromRegistry returns a PromRegistry of buckets, DefaultBuckets when empty
+func NewPromRegistry(buckets ...float64) *PromRegistry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sort.Float64s(buckets)
+	return &PromRegistry{
+		buckets:    buckets,
+		counters:   map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+}
+
+func (r *PromRegistry) Inc(name string, labels ...string) {
+	key := labelString(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series, ok := r.counters[name]
+	if !ok {
+		series = map[string]float64{}
+		r.counters[name] = series
+	}
+	series[key]++
+}
+
+func (r *PromRegistry) Observe(name string, value float64, labels ...string) {
+	key := labelString(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series, ok := r.histograms[name]
+	if !ok {
+		series = map[string]*histogram{}
+		r.histograms[name] = series
+	}
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(r.buckets))}
+		series[key] = h
+	}
+	for i, bound := range r.buckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (r *PromRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(r.String()))
+}
+
+// String returns the metrics in the Prometheus text format
+func (r *PromRegistry) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sb strings.Builder
+	for _, name := range sortedKeys(r.counters) {
+		writeMetricHeader(&sb, name, "counter")
+		series := r.counters[name]
+		for _, key := range sortedKeys(series) {
+			fmt.Fprintf(&sb, "%s%s %s\n", name, braces(key), formatFloat(series[key]))
+		}
+	}
+	for _, name := range sortedKeys(r.histograms) {
+		writeMetricHeader(&sb, name, "histogram")
+		series := r.histograms[name]
+		for _, key := range sortedKeys(series) {
+			h := series[key]
+			var cumulative uint64
+			for i, bound := range r.buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&sb, "%s_bucket%s %d\n", name, braces(joinLabels(key, "le=\""+formatFloat(bound)+"\"")), cumulative)
+			}
+			fmt.Fprintf(&sb, "%s_bucket%s %d\n", name, braces(joinLabels(key, "le=\"+Inf\"")), h.count)
+			fmt.Fprintf(&sb, "%s_sum%s %s\n", name, braces(key), formatFloat(h.sum))
+			fmt.Fprintf(&sb, "%s_count%s %d\n", name, braces(key), h.count)
+		}
+	}
+	return sb.String()
+}
+
+func writeMetricHeader(sb *strings.Builder, name, typ string) {
+	if help, ok := metricHelp[name]; ok {
+		fmt.Fprintf(sb, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, typ)
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+// labelString encodes the name and value pairs of labels as name="value",...
+func labelString(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"=\""+labelEscaper.Replace(labels[i+1])+"\"")
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(key, label string) string {
+	if key == "" {
+		return label
+	}
+	return key + "," + label
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -13,6 +13,9 @@ package svc
 
 import (
 	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,6 +32,7 @@ const (
 
 type CorsOption struct {
 	AccessControlAllowOrigin      string
+	AllowOrigins                  []string // echoes the matched Origin instead of AccessControlAllowOrigin when not empty, overridden by the CorsOrigins of the App Settings; "*" answers a literal * without credentials
 	AccessControlAllowHeaders     string
 	AccessControlAllowMethods     string
 	AccessControlExposeHeaders    string
@@ -38,8 +42,21 @@ type CorsOption struct {
 }
 
 func Cors(configure ...func(opt *CorsOption)) gin.HandlerFunc {
-	dco := CorsOption{
+	dco := defaultCorsOption()
+	return func(ctx *gin.Context) {
+		if len(configure) > 0 {
+			if conf := configure[0]; conf != nil {
+				conf(&dco)
+			}
+		}
+		cors(ctx, &dco, appOf(ctx).snapshot())
+	}
+}
+
+func defaultCorsOption() CorsOption {
+	return CorsOption{
 		"*",
+		nil,
 		"*",
 		"POST, GET, OPTIONS, PUT, DELETE",
 		"Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type",
@@ -47,21 +64,63 @@ func Cors(configure ...func(opt *CorsOption)) gin.HandlerFunc {
 		func(req *http.Request) (ok bool) { m := req.Method; return m == mo || m == mh },
 		func(ctx *gin.Context) { ctx.AbortWithStatus(http.StatusNoContent) },
 	}
-	return func(ctx *gin.Context) {
-		if len(configure) > 0 {
-			if conf := configure[0]; conf != nil {
-				conf(&dco)
-			}
-		}
-		ctx.Header(aCAO, dco.AccessControlAllowOrigin)
-		ctx.Header(aCAH, dco.AccessControlAllowHeaders)
-		ctx.Header(aCAM, dco.AccessControlAllowMethods)
-		ctx.Header(aCEH, dco.AccessControlExposeHeaders)
+}
+
+func cors(ctx *gin.Context, dco *CorsOption, s *Settings) {
+	origins := dco.AllowOrigins
+	if s != nil && len(s.CorsOrigins) > 0 {
+		origins = s.CorsOrigins
+	}
+	origin, wildcard := allowOrigin(dco.AccessControlAllowOrigin, origins, ctx.GetHeader("Origin"))
+	ctx.Header(aCAO, origin)
+	if len(origins) > 0 && !containsString(ctx.Writer.Header().Values("Vary"), "Origin") {
+		ctx.Writer.Header().Add("Vary", "Origin")
+	}
+	ctx.Header(aCAH, dco.AccessControlAllowHeaders)
+	ctx.Header(aCAM, dco.AccessControlAllowMethods)
+	ctx.Header(aCEH, dco.AccessControlExposeHeaders)
+	if !wildcard {
 		ctx.Header(aCAC, dco.AccessControlAllowCredentials)
-		if dco.PreflightCond(ctx.Request) {
-			dco.PreflightFunc(ctx)
+	}
+	if dco.PreflightCond(ctx.Request) {
+		dco.PreflightFunc(ctx)
+		return
+	}
+	ctx.Next()
+}
+
+// corsName is the name of the handlers of Cors, all of them are the same closure
+var corsName string
+
+func init() { corsName = runtime.FuncForPC(reflect.ValueOf(Cors()).Pointer()).Name() }
+
+// settingsCors runs the default Cors for all the routes of app while its Settings have CorsOrigins,
+// so the origins of ApplyConfig, SetSettings and WatchSettings apply at once.
+// It leaves the requests to a Cors mounted on their handlers chain, which applies the CorsOrigins too
+func settingsCors(app *App) gin.HandlerFunc {
+	dco := defaultCorsOption()
+	return func(ctx *gin.Context) {
+		if s := app.snapshot(); s != nil && len(s.CorsOrigins) > 0 && !containsString(ctx.HandlerNames(), corsName) {
+			cors(ctx, &dco, s)
 			return
 		}
 		ctx.Next()
 	}
 }
+
+// allowOrigin returns the Access-Control-Allow-Origin of origin, wildcard reports the "*" of origins,
+// answered by a literal * as echoing any Origin with credentials would share them with every site
+func allowOrigin(allow string, origins []string, origin string) (allowed string, wildcard bool) {
+	if len(origins) == 0 {
+		return allow, false
+	}
+	for _, o := range origins {
+		if o == "*" {
+			return "*", true
+		}
+		if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return origin, false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func corsPreflight(app *App) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/ping", nil)
+	req.Header.Set("Origin", "https://a.example")
+	app.ServeHTTP(w, req)
+	return w
+}
+
+func TestSettingsCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	if err := app.SetSettings(Settings{CorsOrigins: []string{"https://a.example"}}); err != nil {
+		t.Fatal(err)
+	}
+	w := corsPreflight(app)
+	if w.Code != http.StatusNoContent || w.Header().Get(aCAO) != "https://a.example" || w.Header().Get(aCAC) != "true" {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestSettingsCorsDefersToCors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	app.Use(Cors(func(opt *CorsOption) {
+		opt.AccessControlAllowHeaders = "X-Custom"
+		opt.PreflightFunc = func(ctx *gin.Context) { ctx.AbortWithStatus(http.StatusOK) }
+	}))
+	if err := app.SetSettings(Settings{CorsOrigins: []string{"https://a.example"}}); err != nil {
+		t.Fatal(err)
+	}
+	w := corsPreflight(app)
+	if w.Code != http.StatusOK || w.Header().Get(aCAH) != "X-Custom" || w.Header().Get(aCAO) != "https://a.example" {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCorsWildcardOmitsCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	if err := app.SetSettings(Settings{CorsOrigins: []string{"*"}}); err != nil {
+		t.Fatal(err)
+	}
+	w := corsPreflight(app)
+	if w.Header().Get(aCAO) != "*" || w.Header().Get(aCAC) != "" {
+		t.Fatalf("got %v", w.Header())
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileStream is a multipart file read straight from the request body instead of buffered to disk,
+// the parts after it are not read, so it must be the last part of the request
+type FileStream struct {
+	Filename    string
+	ContentType string
+	Reader      io.Reader
+}
+
+var (
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+	fileStreamType = reflect.TypeOf(FileStream{})
+)
+
+// fileRule is the file tag of a file field, e.g. `file:"maxSize=5MB,maxCount=3,types=image/png|image/*"`
+type fileRule struct {
+	maxSize  int64
+	maxCount int
+	types    []string
+	err      error
+}
+
+func parseFileRule(tagValue string) *fileRule {
+	rule := &fileRule{}
+	var opt string
+	for len(tagValue) > 0 {
+		opt, tagValue = head(tagValue, ",")
+		switch k, v := head(opt, "="); k {
+		case "maxSize":
+			if rule.maxSize, rule.err = parseSize(v); rule.err != nil {
+				return rule
+			}
+		case "maxCount":
+			if rule.maxCount, rule.err = strconv.Atoi(v); rule.err != nil {
+				return rule
+			}
+		case "types":
+			rule.types = strings.Split(v, "|")
+		}
+	}
+	return rule
+}
+
+// parseSize parses sizes like 512, 512B, 64KB, 5MB or 1GB
+func parseSize(size string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(size))
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		unit   int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(str, u.suffix) {
+			str, unit = strings.TrimSpace(strings.TrimSuffix(str, u.suffix)), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not valid file size", size)
+	}
+	return n * unit, nil
+}
+
+func (r *fileRule) allows(contentType string) bool {
+	if len(r.types) == 0 {
+		return true
+	}
+	mt := mediaType(contentType)
+	for _, t := range r.types {
+		if t == mt || strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *fileRule) check(key string, files []*multipart.FileHeader) error {
+	if r == nil {
+		return nil
+	}
+	if r.err != nil {
+		return r.err
+	}
+	var fields []FieldError
+	if r.maxCount > 0 && len(files) > r.maxCount {
+		fields = append(fields, FieldError{Field: key, Reason: "too_many_files"})
+	}
+	for _, fh := range files {
+		if r.maxSize > 0 && fh.Size > r.maxSize {
+			fields = append(fields, FieldError{Field: key, Reason: "too_large"})
+		}
+		if !r.allows(fh.Header.Get("Content-Type")) {
+			fields = append(fields, FieldError{Field: key, Reason: "unsupported_type"})
+		}
+	}
+	if len(fields) > 0 {
+		return &BindError{Fields: fields}
+	}
+	return nil
+}
+
+type multipartSource struct {
+	values  map[string][]string
+	files   map[string][]*multipart.FileHeader
+	streams map[string]*FileStream
+}
+
+var _ setter = multipartSource{}
+
+// TrySet tries to set a value by the files and values of a multipart request
+func (r multipartSource) TrySet(value reflect.Value, field reflect.StructField, key string, opt setOptions) (bool, error) {
+	if files := r.files[key]; len(files) != 0 {
+		return setByMultipartFormFile(value, key, files, opt)
+	}
+	if stream, ok := r.streams[key]; ok && value.Type() == fileStreamType {
+		return setByFileStream(value, key, stream, opt)
+	}
+	return setByForm(value, field, r.values, key, opt)
+}
+
+func setByMultipartFormFile(value reflect.Value, key string, files []*multipart.FileHeader, opt setOptions) (bool, error) {
+	if err := opt.file.check(key, files); err != nil {
+		return false, err
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if value.Type() == fileHeaderType {
+			value.Set(reflect.ValueOf(*files[0]))
+			return true, nil
+		}
+	case reflect.Slice, reflect.Array:
+		elemType := value.Type().Elem()
+		if elemType != fileHeaderType && (elemType.Kind() != reflect.Ptr || elemType.Elem() != fileHeaderType) {
+			return false, nil
+		}
+		slice := value
+		if value.Kind() == reflect.Array {
+			if len(files) != value.Len() {
+				return false, fmt.Errorf("%d files is not valid for %s", len(files), value.Type().String())
+			}
+		} else {
+			slice = reflect.MakeSlice(value.Type(), len(files), len(files))
+		}
+		for i, fh := range files {
+			if elemType.Kind() == reflect.Ptr {
+				slice.Index(i).Set(reflect.ValueOf(fh))
+			} else {
+				slice.Index(i).Set(reflect.ValueOf(*fh))
+			}
+		}
+		if value.Kind() == reflect.Slice {
+			value.Set(slice)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func setByFileStream(value reflect.Value, key string, stream *FileStream, opt setOptions) (bool, error) {
+	if rule := opt.file; rule != nil {
+		if rule.err != nil {
+			return false, rule.err
+		}
+		if !rule.allows(stream.ContentType) {
+			return false, &BindError{Fields: []FieldError{{Field: key, Reason: "unsupported_type"}}}
+		}
+		if rule.maxSize > 0 {
+			stream.Reader = &limitedStream{r: stream.Reader, max: rule.maxSize, key: key}
+		}
+	}
+	value.Set(reflect.ValueOf(*stream))
+	return true, nil
+}
+
+// limitedStream fails with a too_large *BindError once more than max bytes are read
+type limitedStream struct {
+	r    io.Reader
+	max  int64
+	read int64
+	key  string
+}
+
+func (l *limitedStream) Read(p []byte) (n int, err error) {
+	n, err = l.r.Read(p)
+	if l.read += int64(n); l.read > l.max {
+		n -= int(l.read - l.max)
+		l.read = l.max
+		return n, &BindError{Fields: []FieldError{{Field: l.key, Reason: "too_large"}}}
+	}
+	return
+}
+
+func hasFileStream(ptr any) bool {
+	typ := reflect.TypeOf(ptr)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && cachedPlan(typ, "form").streams
+}
+
+// bindMultipartStream reads the value parts up to the first file part, which is handed as FileStream
+func bindMultipartStream(ctx *gin.Context, ptr any) error {
+	mr, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return err
+	}
+	query, body := ctx.Request.URL.Query(), make(map[string][]string)
+	streams := make(map[string]*FileStream)
+	for {
+		part, pErr := mr.NextPart()
+		if errors.Is(pErr, io.EOF) {
+			break
+		}
+		if pErr != nil {
+			return pErr
+		}
+		if part.FileName() == "" {
+			buf, rErr := io.ReadAll(io.LimitReader(part, defaultMultipartMemory+1))
+			if rErr != nil {
+				return rErr
+			}
+			if len(buf) > defaultMultipartMemory {
+				return &BindError{Fields: []FieldError{{Field: part.FormName(), Reason: "too_large"}}}
+			}
+			body[part.FormName()] = append(body[part.FormName()], string(buf))
+			continue
+		}
+		streams[part.FormName()] = &FileStream{Filename: part.FileName(), ContentType: part.Header.Get("Content-Type"), Reader: part}
+		break
+	}
+	// the body values come before the query ones, like in http.Request.Form
+	values := make(map[string][]string, len(query)+len(body))
+	for _, source := range []map[string][]string{body, query} {
+		for k, v := range source {
+			values[k] = append(values[k], v...)
+		}
+	}
+	return mapSourceStrict(ctx, ptr, values, multipartSource{values: values, streams: streams}, body, query)
+}
+
+func fileRulesOf(ptr any) map[string]*fileRule {
+	typ := reflect.TypeOf(ptr)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	return cachedPlan(typ, "form").files
+}
+
+// parseMultipartLimited parses the multipart form like ParseMultipartForm, but fails on the first file part
+// breaking its rule while the body is read, instead of after the whole body is buffered
+func parseMultipartLimited(req *http.Request, rules map[string]*fileRule) error {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return http.ErrMissingBoundary
+	}
+	boundary := params["boundary"]
+	// the body read by the checking reader is teed to ReadForm, which builds the form as usual
+	pr, pw := io.Pipe()
+	type result struct {
+		form *multipart.Form
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		form, rErr := multipart.NewReader(pr, boundary).ReadForm(defaultMultipartMemory)
+		if rErr != nil {
+			_ = pr.CloseWithError(rErr)
+		} else {
+			_, _ = io.Copy(io.Discard, pr) // the epilogue
+		}
+		done <- result{form, rErr}
+	}()
+	err = checkMultipartParts(multipart.NewReader(io.TeeReader(req.Body, pw), boundary), rules)
+	_ = pw.CloseWithError(err)
+	res := <-done
+	if err != nil {
+		if res.form != nil {
+			_ = res.form.RemoveAll()
+		}
+		return err
+	}
+	if res.err != nil {
+		return res.err
+	}
+	if req.Form == nil {
+		if err = req.ParseForm(); err != nil {
+			return err
+		}
+	}
+	for k, v := range res.form.Value {
+		req.Form[k] = append(req.Form[k], v...)
+		req.PostForm[k] = append(req.PostForm[k], v...)
+	}
+	req.MultipartForm = res.form
+	return nil
+}
+
+func checkMultipartParts(mr *multipart.Reader, rules map[string]*fileRule) error {
+	counts := make(map[string]int)
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var reader io.Reader = part
+		if key, rule := part.FormName(), rules[part.FormName()]; rule != nil && part.FileName() != "" {
+			if rule.err != nil {
+				return rule.err
+			}
+			if counts[key]++; rule.maxCount > 0 && counts[key] > rule.maxCount {
+				return &BindError{Fields: []FieldError{{Field: key, Reason: "too_many_files"}}}
+			}
+			if !rule.allows(part.Header.Get("Content-Type")) {
+				return &BindError{Fields: []FieldError{{Field: key, Reason: "unsupported_type"}}}
+			}
+			if rule.maxSize > 0 {
+				reader = &limitedStream{r: part, max: rule.maxSize, key: key}
+			}
+		}
+		if _, err = io.Copy(io.Discard, reader); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RateLimitAlgorithm int
+
+const (
+	TokenBucket RateLimitAlgorithm = iota
+	SlidingWindow
+)
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the limit is fully available again
+	RetryAfter time.Duration // of the denied requests
+}
+
+// RateLimitStore keeps the rate limit states by key, the in-memory store by default, a shared one for distributed limits
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit, algorithm RateLimitAlgorithm) (result RateLimitResult, err error)
+}
+
+var (
+	ErrTooManyRequests = NewErrorWithCodes("too many requests", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	// ErrRateLimitUnavailable rejects the requests of a FailClosed RateLimiter whose Store fails
+	ErrRateLimitUnavailable = NewErrorWithCodes("rate limit unavailable", http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+)
+
+type RateLimitOption struct {
+	Name       string    // prefixes the keys, distinguishing the limits sharing a Store
+	Limit      RateLimit // 0 Limit uses the RateLimit of the App Settings per request
+	Algorithm  RateLimitAlgorithm
+	Key        func(ctx *gin.Context) (key string) // KeyByIP when nil
+	Store      RateLimitStore                      // a new in-memory store when nil
+	FailClosed bool                                // rejects with 503 when Store fails instead of letting the requests through
+	Encrypt    bool                                // encrypts the 429 and 503 responses
+}
+
+// RateLimiter limits the requests of the routes or route group using it by the key of each request,
+// setting the X-RateLimit-* headers and rejecting with 429 and Retry-After
+func RateLimiter(configure ...func(opt *RateLimitOption)) gin.HandlerFunc {
+	opt := RateLimitOption{Name: "svc", Key: KeyByIP}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	if opt.Store == nil {
+		opt.Store = NewMemoryRateLimitStore()
+	}
+	return func(ctx *gin.Context) {
+		limit := opt.Limit
+		if limit.Limit <= 0 {
+			if s := appOf(ctx).snapshot(); s != nil {
+				limit = s.RateLimit
+			}
+		}
+		if limit.Limit <= 0 || limit.Window <= 0 {
+			ctx.Next()
+			return
+		}
+		result, err := opt.Store.Take(ctx.Request.Context(), opt.Name+":"+opt.Key(ctx), limit, opt.Algorithm)
+		if err != nil {
+			slog.Warn("svc: rate limit store", "err", err, "fail_closed", opt.FailClosed)
+			if opt.FailClosed {
+				ctx.Abort()
+				WriteJSON(ctx, http.StatusServiceUnavailable, http.StatusServiceUnavailable, "", ErrRateLimitUnavailable, nil, opt.Encrypt)
+				return
+			}
+			ctx.Next()
+			return
+		}
+		header := ctx.Writer.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			ctx.Abort()
+			WriteJSON(ctx, http.StatusTooManyRequests, http.StatusTooManyRequests, "", ErrTooManyRequests, nil, opt.Encrypt)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int { return int(math.Ceil(d.Seconds())) }
+
+func KeyByIP(ctx *gin.Context) string { return "ip:" + ctx.ClientIP() }
+
+// KeyByPrincipal keys by the subject of the *Principal authenticated by Auth, by IP for the anonymous requests
+func KeyByPrincipal(ctx *gin.Context) string {
+	if principal, ok := PrincipalOf[*Principal](ctx); ok && principal.Subject != "" {
+		return "sub:" + principal.Subject
+	}
+	return KeyByIP(ctx)
+}
+
+// KeyByAPIKey keys by the hash of the API key of header, by IP for the requests without it
+func KeyByAPIKey(header string) func(ctx *gin.Context) string {
+	return func(ctx *gin.Context) string {
+		if key := ctx.GetHeader(header); key != "" {
+			sum := sha256.Sum256([]byte(key))
+			return "key:" + hex.EncodeToString(sum[:8])
+		}
+		return KeyByIP(ctx)
+	}
+}
+
+// MemoryRateLimitStore is the RateLimitStore of a single process
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*rateState
+	takes     int
+	now       func() time.Time
+	sweepSize int
+}
+
+type rateState struct {
+	tokens   float64   // of TokenBucket
+	start    time.Time // of the current window of SlidingWindow
+	cur      int
+	prev     int
+	lastSeen time.Time
+	window   time.Duration
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*rateState{}, now: time.Now, sweepSize: 1024}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit, algorithm RateLimitAlgorithm) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	window := time.Duration(limit.Window)
+	state, ok := s.buckets[key+":"+strconv.Itoa(int(algorithm))]
+	if !ok {
+		state = &rateState{tokens: float64(limit.Limit), start: now.Truncate(window)}
+		s.buckets[key+":"+strconv.Itoa(int(algorithm))] = state
+	}
+	state.window = window
+	defer func() { state.lastSeen = now }()
+	if algorithm == SlidingWindow {
+		return state.slide(now, limit.Limit, window), nil
+	}
+	return state.bucket(now, limit.Limit, window), nil
+}
+
+// sweep drops the idle states every sweepSize takes
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if s.takes++; s.takes < s.sweepSize {
+		return
+	}
+	s.takes = 0
+	for key, state := range s.buckets {
+		if now.Sub(state.lastSeen) > 2*state.window {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// bucket holds limit tokens refilled at limit per window
+func (st *rateState) bucket(now time.Time, limit int, window time.Duration) RateLimitResult {
+	rate := float64(limit) / window.Seconds()
+	if !st.lastSeen.IsZero() {
+		st.tokens = math.Min(float64(limit), st.tokens+now.Sub(st.lastSeen).Seconds()*rate)
+	}
+	if st.tokens < 1 {
+		return RateLimitResult{
+			Reset:      seconds((float64(limit) - st.tokens) / rate),
+			RetryAfter: seconds((1 - st.tokens) / rate),
+		}
+	}
+	st.tokens--
+	return RateLimitResult{Allowed: true, Remaining: int(st.tokens), Reset: seconds((float64(limit) - st.tokens) / rate)}
+}
+
+// slide weighs the count of the previous window by its part still inside the sliding window
+func (st *rateState) slide(now time.Time, limit int, window time.Duration) RateLimitResult {
+	if start := now.Truncate(window); !start.Equal(st.start) {
+		if start.Sub(st.start) == window {
+			st.prev = st.cur
+		} else {
+			st.prev = 0
+		}
+		st.start, st.cur = start, 0
+	}
+	elapsed := now.Sub(st.start)
+	count := float64(st.prev)*(1-float64(elapsed)/float64(window)) + float64(st.cur)
+	reset := window - elapsed
+	if count+1 > float64(limit) {
+		return RateLimitResult{Reset: reset, RetryAfter: st.retryAfter(limit, window, elapsed)}
+	}
+	st.cur++
+	return RateLimitResult{Allowed: true, Remaining: int(float64(limit) - count - 1), Reset: reset}
+}
+
+// retryAfter returns the wait until the weighted count leaves room for one more request
+func (st *rateState) retryAfter(limit int, window, elapsed time.Duration) time.Duration {
+	w := float64(window)
+	if st.cur+1 <= limit && st.prev > 0 {
+		t := w*(1-float64(limit-st.cur-1)/float64(st.prev)) - float64(elapsed)
+		if t >= 0 && t < w-float64(elapsed) {
+			return time.Duration(t)
+		}
+	}
+	next := 0.0
+	if st.cur > 0 {
+		next = math.Max(0, w*(1-float64(limit-1)/float64(st.cur)))
+	}
+	return window - elapsed + time.Duration(next)
+}
+
+func seconds(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
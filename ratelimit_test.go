@@ -0,0 +1,98 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is the injectable now of a MemoryRateLimitStore
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newClockedStore() (*MemoryRateLimitStore, *fakeClock) {
+	// a multiple of the windows, the sliding windows start at it
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	store := NewMemoryRateLimitStore()
+	store.now = clock.now
+	return store, clock
+}
+
+func TestTokenBucket(t *testing.T) {
+	store, clock := newClockedStore()
+	limit := RateLimit{Limit: 2, Window: Duration(10 * time.Second)}
+	for i, want := range []struct {
+		advance time.Duration
+		result  RateLimitResult
+	}{
+		{0, RateLimitResult{Allowed: true, Remaining: 1, Reset: 5 * time.Second}},
+		{0, RateLimitResult{Allowed: true, Remaining: 0, Reset: 10 * time.Second}},
+		{0, RateLimitResult{Reset: 10 * time.Second, RetryAfter: 5 * time.Second}},
+		{5 * time.Second, RateLimitResult{Allowed: true, Remaining: 0, Reset: 10 * time.Second}},
+		{2500 * time.Millisecond, RateLimitResult{Reset: 7500 * time.Millisecond, RetryAfter: 2500 * time.Millisecond}},
+		{20 * time.Second, RateLimitResult{Allowed: true, Remaining: 1, Reset: 5 * time.Second}},
+	} {
+		clock.t = clock.t.Add(want.advance)
+		got, err := store.Take(context.Background(), "k", limit, TokenBucket)
+		if err != nil || got != want.result {
+			t.Fatalf("take %d: got %+v, %v, want %+v", i, got, err, want.result)
+		}
+	}
+}
+
+func TestSlidingWindowRetryAfter(t *testing.T) {
+	limit := RateLimit{Limit: 4, Window: Duration(10 * time.Second)}
+	for _, tc := range []struct {
+		name       string
+		setup      func(store *MemoryRateLimitStore, clock *fakeClock) // fills the limit
+		retryAfter time.Duration
+	}{
+		{"the current window full", func(store *MemoryRateLimitStore, clock *fakeClock) {
+			for i := 0; i < 4; i++ {
+				_, _ = store.Take(context.Background(), "k", limit, SlidingWindow)
+			}
+		}, 12500 * time.Millisecond},
+		{"the previous window full", func(store *MemoryRateLimitStore, clock *fakeClock) {
+			for i := 0; i < 4; i++ {
+				_, _ = store.Take(context.Background(), "k", limit, SlidingWindow)
+			}
+			clock.t = clock.t.Add(10 * time.Second)
+		}, 2500 * time.Millisecond},
+		{"both windows", func(store *MemoryRateLimitStore, clock *fakeClock) {
+			for i := 0; i < 4; i++ {
+				_, _ = store.Take(context.Background(), "k", limit, SlidingWindow)
+			}
+			clock.t = clock.t.Add(15 * time.Second)
+			_, _ = store.Take(context.Background(), "k", limit, SlidingWindow)
+			_, _ = store.Take(context.Background(), "k", limit, SlidingWindow)
+		}, 2500 * time.Millisecond},
+	} {
+		store, clock := newClockedStore()
+		tc.setup(store, clock)
+		denied, _ := store.Take(context.Background(), "k", limit, SlidingWindow)
+		if denied.Allowed || denied.RetryAfter != tc.retryAfter {
+			t.Fatalf("%s: got %+v, want RetryAfter %v", tc.name, denied, tc.retryAfter)
+		}
+		at := clock.t
+		clock.t = at.Add(tc.retryAfter - 100*time.Millisecond)
+		if early, _ := store.Take(context.Background(), "k", limit, SlidingWindow); early.Allowed {
+			t.Fatalf("%s: allowed before RetryAfter", tc.name)
+		}
+		clock.t = at.Add(tc.retryAfter)
+		if retried, _ := store.Take(context.Background(), "k", limit, SlidingWindow); !retried.Allowed {
+			t.Fatalf("%s: denied at RetryAfter: %+v", tc.name, retried)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+	requestIDKey    = "svc_request_id"
+)
+
+type requestIDCtxKey struct{}
+
+type RequestIDOption struct {
+	Header    string
+	Generator func() (id string)
+	Accept    func(id string) (ok bool) // of the incoming ids, the rejected ones are regenerated
+}
+
+// RequestID accepts the request id of the header or generates one, stores it in the gin context
+// and the request context, then echoes it in the response header
+func RequestID(configure ...func(opt *RequestIDOption)) gin.HandlerFunc {
+	opt := RequestIDOption{Header: RequestIDHeader, Generator: newRequestID, Accept: acceptRequestID}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(opt.Header)
+		if id == "" || !opt.Accept(id) {
+			id = opt.Generator()
+		}
+		ctx.Set(requestIDKey, id)
+		ctx.Request = ctx.Request.WithContext(WithRequestID(ctx.Request.Context(), id))
+		ctx.Header(opt.Header, id)
+		ctx.Next()
+	}
+}
+
+// WithRequestID returns a copy of ctx carrying id, forwarded by HttpDoCtx
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey{}, id)
+}
+
+// RequestIDOf returns the request id carried by ctx, a *gin.Context or its request context
+func RequestIDOf(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if id, ok := requestContext(ctx).Value(requestIDCtxKey{}).(string); ok {
+		return id
+	}
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		return ginCtx.GetString(requestIDKey)
+	}
+	return ""
+}
+
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+	buf := make([]byte, 36)
+	hex.Encode(buf, b[:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf)
+}
+
+// acceptRequestID accepts the ids of at most 128 visible ASCII characters
+func acceptRequestID(id string) bool {
+	if len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
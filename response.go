@@ -0,0 +1,227 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The RESP types below are rendered as is instead of JSON, File and Raw bodies are encrypted
+// when the route encrypts, Stream, Redirect and NoContent never are
+type (
+	// File is written as a download, or inline when Inline is set,
+	// a Reader implementing io.ReadSeeker is served with Range and conditional requests support
+	File struct {
+		Name        string
+		Reader      io.Reader
+		ContentType string
+		ModTime     time.Time
+		Inline      bool
+	}
+
+	// Stream copies Reader to the response flushing every chunk
+	Stream struct {
+		ContentType string
+		Reader      io.Reader
+	}
+
+	// Redirect redirects to URL, Code defaults to 302 and must be within 300-308
+	Redirect struct {
+		URL  string
+		Code int
+	}
+
+	Raw struct {
+		ContentType string
+		Bytes       []byte
+	}
+
+	NoContent struct{}
+)
+
+var (
+	errNoReader     = errors.New("svc: response has no Reader")
+	errNilResponse  = errors.New("svc: response is nil")
+	errRedirectCode = errors.New("svc: redirect code is not 3xx")
+)
+
+func writeResp(ctx *gin.Context, resp any, encrypt bool) {
+	if err := checkResp(resp); err != nil {
+		WriteServerErrorJSON(ctx, err, encrypt)
+		return
+	}
+	switch r := resp.(type) {
+	case File:
+		writeFile(ctx, &r, encrypt)
+	case *File:
+		writeFile(ctx, r, encrypt)
+	case Stream:
+		writeStream(ctx, &r)
+	case *Stream:
+		writeStream(ctx, r)
+	case Redirect:
+		writeRedirect(ctx, &r)
+	case *Redirect:
+		writeRedirect(ctx, r)
+	case Raw:
+		writeRaw(ctx, r.ContentType, r.Bytes, encrypt)
+	case *Raw:
+		writeRaw(ctx, r.ContentType, r.Bytes, encrypt)
+	case NoContent, *NoContent:
+		ctx.Status(http.StatusNoContent)
+	default:
+		if respType := reflect.TypeOf(resp); respType != nil {
+			respTypeKind := respType.Kind()
+			switch {
+			case respTypeKind == reflect.String: // for func() (str string, err error)
+				respStr := fmt.Sprintf("%v", resp)
+				if encrypt {
+					encryptStr, _ := appOf(ctx).aesEncrypt([]byte(respStr))
+					ctx.String(http.StatusOK, encryptStr)
+				} else {
+					ctx.String(http.StatusOK, respStr)
+				}
+			default:
+				WriteSuccessJSON(ctx, resp, encrypt)
+			}
+		}
+	}
+}
+
+// checkResp rejects the responses which can not be written, like a File without Reader
+func checkResp(resp any) error {
+	switch r := resp.(type) {
+	case *File:
+		if r == nil {
+			return errNilResponse
+		}
+		return checkResp(*r)
+	case *Stream:
+		if r == nil {
+			return errNilResponse
+		}
+		return checkResp(*r)
+	case *Redirect:
+		if r == nil {
+			return errNilResponse
+		}
+		return checkResp(*r)
+	case *Raw:
+		if r == nil {
+			return errNilResponse
+		}
+	case File:
+		if r.Reader == nil {
+			return errNoReader
+		}
+	case Stream:
+		if r.Reader == nil {
+			return errNoReader
+		}
+	case Redirect:
+		if r.Code != 0 && (r.Code < http.StatusMultipleChoices || r.Code > http.StatusPermanentRedirect) {
+			return fmt.Errorf("%w: %d", errRedirectCode, r.Code)
+		}
+	}
+	return nil
+}
+
+func writeFile(ctx *gin.Context, file *File, encrypt bool) {
+	if closer, ok := file.Reader.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(filepath.Ext(file.Name)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	disposition := "attachment"
+	if file.Inline {
+		disposition = "inline"
+	}
+	if file.Name != "" {
+		disposition = mime.FormatMediaType(disposition, map[string]string{"filename": file.Name})
+	}
+	ctx.Header("Content-Disposition", disposition)
+	if encrypt {
+		buf, err := io.ReadAll(file.Reader)
+		if err != nil {
+			WriteServerErrorJSON(ctx, err, encrypt)
+			return
+		}
+		writeRaw(ctx, contentType, buf, encrypt)
+		return
+	}
+	ctx.Header("Content-Type", contentType)
+	if rs, ok := file.Reader.(io.ReadSeeker); ok {
+		http.ServeContent(ctx.Writer, ctx.Request, file.Name, file.ModTime, rs)
+		return
+	}
+	ctx.Status(http.StatusOK)
+	_, _ = io.Copy(ctx.Writer, file.Reader)
+}
+
+func writeStream(ctx *gin.Context, stream *Stream) {
+	if closer, ok := stream.Reader.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+	contentType := stream.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Status(http.StatusOK)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Reader.Read(buf)
+		if n > 0 {
+			if _, wErr := ctx.Writer.Write(buf[:n]); wErr != nil {
+				return
+			}
+			ctx.Writer.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeRedirect(ctx *gin.Context, redirect *Redirect) {
+	code := redirect.Code
+	if code == 0 {
+		code = http.StatusFound
+	}
+	ctx.Redirect(code, redirect.URL)
+}
+
+func writeRaw(ctx *gin.Context, contentType string, buf []byte, encrypt bool) {
+	if contentType == "" {
+		contentType = http.DetectContentType(buf)
+	}
+	if encrypt {
+		encryptStr, _ := appOf(ctx).encryptTo(ctx.Writer.Header(), contentType, buf)
+		ctx.String(http.StatusOK, encryptStr)
+		return
+	}
+	ctx.DataFromReader(http.StatusOK, int64(len(buf)), contentType, bytes.NewReader(buf), nil)
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type RunOption struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration // 0 for the routes streaming longer than it
+	IdleTimeout       time.Duration
+	ShutdownDelay     time.Duration    // waited after readiness turns false, before draining
+	ShutdownTimeout   time.Duration    // deadline of draining and the OnStop hooks, 30s when 0
+	Listener          net.Listener     // listens on addr when nil
+	Signals           <-chan os.Signal // SIGINT and SIGTERM when nil
+}
+
+const defaultShutdownTimeout = 30 * time.Second
+
+type Hook func(ctx context.Context) (err error)
+
+// OnStart registers hooks run in order before serving, the first error stops Run
+func (app *App) OnStart(hooks ...Hook) { app.onStart = append(app.onStart, hooks...) }
+
+// OnStop registers hooks run in order after draining, or after serving failed once the OnStart hooks ran
+func (app *App) OnStop(hooks ...Hook) { app.onStop = append(app.onStop, hooks...) }
+
+const (
+	stateIdle int32 = iota
+	stateServing
+	stateStopping
+)
+
+// Ready reports whether the App is serving by Run and not shutting down
+func (app *App) Ready() bool { return atomic.LoadInt32(&app.state) == stateServing }
+
+func (app *App) stopping() bool { return atomic.LoadInt32(&app.state) == stateStopping }
+
+func (app *App) setState(state int32) { atomic.StoreInt32(&app.state, state) }
+
+// Run serves the App on addr, the Addr of the applied Config when empty, until SIGINT or SIGTERM, then it marks the App not ready,
+// drains the in-flight requests within ShutdownTimeout, closing the WebSocket connections with 1001 going away, and runs the OnStop hooks
+func (app *App) Run(addr string, configure ...func(opt *RunOption)) (err error) {
+	ro := RunOption{
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   defaultShutdownTimeout,
+	}
+	if cfg := app.config; cfg != nil {
+		ro.ReadTimeout = time.Duration(cfg.ReadTimeout)
+		ro.ReadHeaderTimeout = time.Duration(cfg.ReadHeaderTimeout)
+		ro.WriteTimeout = time.Duration(cfg.WriteTimeout)
+		ro.IdleTimeout = time.Duration(cfg.IdleTimeout)
+		ro.ShutdownTimeout = time.Duration(cfg.ShutdownTimeout)
+		if addr == "" {
+			addr = cfg.Addr
+		}
+	}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&ro)
+		}
+	}
+	if ro.ShutdownTimeout <= 0 {
+		ro.ShutdownTimeout = defaultShutdownTimeout
+	}
+	signals := ro.Signals
+	if signals == nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(ch)
+		signals = ch
+	}
+	ln := ro.Listener
+	if ln == nil {
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return
+		}
+	}
+	for _, hook := range app.onStart {
+		if err = hook(context.Background()); err != nil {
+			_ = ln.Close()
+			return
+		}
+	}
+	srv := &http.Server{
+		Handler:           app.Engine,
+		ReadTimeout:       ro.ReadTimeout,
+		ReadHeaderTimeout: ro.ReadHeaderTimeout,
+		WriteTimeout:      ro.WriteTimeout,
+		IdleTimeout:       ro.IdleTimeout,
+	}
+	// the request contexts are cancelled once shutdown starts, so the long handlers return within the drain
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+	srv.BaseContext = func(net.Listener) context.Context { return baseCtx }
+	srv.RegisterOnShutdown(cancelBase)
+	srv.RegisterOnShutdown(app.closeWebSockets)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+	app.setState(stateServing)
+
+	select {
+	case err = <-serveErr:
+		app.setState(stateIdle)
+		cancelBase()
+		ctx, cancel := context.WithTimeout(context.Background(), ro.ShutdownTimeout)
+		defer cancel()
+		app.stop(ctx)
+		return
+	case <-signals:
+	}
+	app.setState(stateStopping)
+	if ro.ShutdownDelay > 0 {
+		time.Sleep(ro.ShutdownDelay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ro.ShutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	if hErr := app.stop(ctx); hErr != nil && err == nil {
+		err = hErr
+	}
+	if sErr := <-serveErr; !errors.Is(sErr, http.ErrServerClosed) && err == nil {
+		err = sErr
+	}
+	return
+}
+
+// stop runs the OnStop hooks in order, returning the first error
+func (app *App) stop(ctx context.Context) (err error) {
+	for _, hook := range app.onStop {
+		if hErr := hook(ctx); hErr != nil && err == nil {
+			err = hErr
+		}
+	}
+	return
+}
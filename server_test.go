@@ -0,0 +1,87 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRunStopsAfterServeFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = ln.Close()
+	app := New()
+	var started, stopped bool
+	app.OnStart(func(context.Context) error { started = true; return nil })
+	app.OnStop(func(context.Context) error { stopped = true; return nil })
+	if err = app.Run("", func(opt *RunOption) { opt.Listener = ln }); err == nil {
+		t.Fatal("want the error of Serve")
+	}
+	if !started || !stopped {
+		t.Fatalf("started %v, stopped %v", started, stopped)
+	}
+}
+
+func TestRunCancelsRequestsOnShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	entered := make(chan struct{})
+	app.GET("/long", func(ctx *gin.Context) {
+		close(entered)
+		<-ctx.Request.Context().Done()
+		ctx.Status(http.StatusServiceUnavailable)
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan os.Signal, 1)
+	ran := make(chan error, 1)
+	go func() {
+		// a ShutdownTimeout of 0 drains within the default instead of expiring at once
+		ran <- app.Run("", func(opt *RunOption) { opt.Listener, opt.Signals, opt.ShutdownTimeout = ln, signals, 0 })
+	}()
+	resp := make(chan int, 1)
+	go func() {
+		r, gErr := http.Get("http://" + ln.Addr().String() + "/long")
+		if gErr != nil {
+			resp <- 0
+			return
+		}
+		_ = r.Body.Close()
+		resp <- r.StatusCode
+	}()
+	<-entered
+	signals <- syscall.SIGTERM
+	select {
+	case err = <-ran:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the long request was not cancelled on shutdown")
+	}
+	if code := <-resp; code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d", code)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Settings are the runtime settings of an App, swapped atomically as a whole by SetSettings
+type Settings struct {
+	EncryptEnable bool              `json:"encrypt_enable" yaml:"encrypt_enable" toml:"encrypt_enable"`
+	DecryptEnable bool              `json:"decrypt_enable" yaml:"decrypt_enable" toml:"decrypt_enable"`
+	AesKey        string            `json:"aes_key" yaml:"aes_key" toml:"aes_key"`
+	AesKeyID      string            `json:"aes_key_id" yaml:"aes_key_id" toml:"aes_key_id"`
+	AesKeyring    map[string]string `json:"aes_keyring" yaml:"aes_keyring" toml:"aes_keyring"` // the retired keys by id, still decrypting the requests of Encryption-Key-Id
+	CorsOrigins   []string          `json:"cors_origins" yaml:"cors_origins" toml:"cors_origins"`
+	RateLimit     RateLimit         `json:"rate_limit" yaml:"rate_limit" toml:"rate_limit"`
+	LogLevel      string            `json:"log_level" yaml:"log_level" toml:"log_level"` // debug, info, warn or error
+}
+
+// RateLimit allows Limit requests per Window, 0 Limit is unlimited
+type RateLimit struct {
+	Limit  int      `json:"limit" yaml:"limit" toml:"limit"`
+	Window Duration `json:"window" yaml:"window" toml:"window"`
+}
+
+const encryptionKeyIDHeader = "Encryption-Key-Id"
+
+var logLevels = []string{"", "debug", "info", "warn", "error"}
+
+// Validate reports all the invalid settings of s
+func (s Settings) Validate() error {
+	var problems []string
+	if (s.EncryptEnable || s.DecryptEnable || s.AesKey != "") && len(s.AesKey) != 16 {
+		problems = append(problems, fmt.Sprintf("aes_key must be 16 bytes, got %d", len(s.AesKey)))
+	}
+	for id, key := range s.AesKeyring {
+		if len(key) != 16 {
+			problems = append(problems, fmt.Sprintf("aes_keyring %q must be 16 bytes, got %d", id, len(key)))
+		}
+	}
+	for _, origin := range s.CorsOrigins {
+		if !validOrigin(origin) {
+			problems = append(problems, fmt.Sprintf("cors_origins %q is not * or scheme://host[:port]", origin))
+		}
+	}
+	if s.RateLimit.Limit < 0 || s.RateLimit.Limit > 0 && s.RateLimit.Window <= 0 {
+		problems = append(problems, "rate_limit needs a positive window and a non negative limit")
+	}
+	if !containsString(logLevels, strings.ToLower(s.LogLevel)) {
+		problems = append(problems, fmt.Sprintf("log_level %q is not debug, info, warn or error", s.LogLevel))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New("svc: invalid settings: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Settings returns the current settings snapshot of app
+func (app *App) Settings() Settings {
+	if s, ok := app.settings.Load().(*Settings); ok {
+		return *s
+	}
+	return Settings{EncryptEnable: EncryptEnable, DecryptEnable: DecryptEnable, AesKey: AesKey()}
+}
+
+// SetSettings validates s, then swaps it in, the requests after it see s as a whole
+func (app *App) SetSettings(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	app.settings.Store(&s)
+	return nil
+}
+
+// snapshot returns the settings stored, nil before the first SetSettings
+func (app *App) snapshot() *Settings {
+	s, _ := app.settings.Load().(*Settings)
+	return s
+}
+
+// LoadSettings reads the settings file of .json, .yaml, .yml or .toml, then sets them
+func (app *App) LoadSettings(file string) error {
+	var s Settings
+	if err := loadConfigFile(file, &s); err != nil {
+		return err
+	}
+	return app.SetSettings(s)
+}
+
+type WatchOption struct {
+	Interval time.Duration
+	OnError  func(err error)
+}
+
+// WatchSettings loads the settings file now and after each change of its modification time,
+// an invalid file keeps the current settings and is reported to OnError
+func (app *App) WatchSettings(file string, configure ...func(opt *WatchOption)) (stop func(), err error) {
+	opt := WatchOption{Interval: 5 * time.Second, OnError: func(err error) { slog.Warn("svc: watch settings", "err", err) }}
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	if err = app.LoadSettings(file); err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(opt.Interval)
+		defer ticker.Stop()
+		modTime := info.ModTime()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, sErr := os.Stat(file)
+			if sErr != nil {
+				opt.OnError(sErr)
+				continue
+			}
+			if info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			if lErr := app.LoadSettings(file); lErr != nil {
+				opt.OnError(lErr)
+			}
+		}
+	}()
+	return func() { close(done) }, nil
+}
+
+// SettingsHandler is the admin endpoint of the settings, GET returns them with the keys redacted
+// and PUT or POST replaces them with the JSON body, protect it by the middlewares of its route
+func (app *App) SettingsHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method == http.MethodGet {
+			WriteSuccessJSON(ctx, app.Settings().redacted())
+			return
+		}
+		var s Settings
+		if err := decodeJSON(ctx.Request.Body, &s, true); err != nil {
+			WriteBindError(ctx, err)
+			return
+		}
+		if err := app.SetSettings(s); err != nil {
+			WriteBindError(ctx, err)
+			return
+		}
+		WriteSuccessJSON(ctx, app.Settings().redacted())
+	}
+}
+
+func (s Settings) redacted() Settings {
+	if s.AesKey != "" {
+		s.AesKey = "******"
+	}
+	if len(s.AesKeyring) > 0 {
+		keyring := make(map[string]string, len(s.AesKeyring))
+		for id := range s.AesKeyring {
+			keyring[id] = "******"
+		}
+		s.AesKeyring = keyring
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+type streamThenFunc[REQ, EVT any] func(req REQ, emitter *Emitter[EVT]) (err error)
+
+func StreamQuery[EVT any](ctx *gin.Context, thenFunc func(emitter *Emitter[EVT]) (err error), encrypts ...bool) {
+	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, nil, streamThenFuncWrap[noReq, EVT](ctx, func(_ noReq, emitter *Emitter[EVT]) error { return thenFunc(emitter) }, encrypts...), encrypts...)
+}
+
+func StreamQueryReq[REQ, EVT any](ctx *gin.Context, req REQ, thenFunc streamThenFunc[REQ, EVT], encrypts ...bool) {
+	do[REQ, noResp](ctx, req, bindQuery[REQ], normalize[REQ], validate[REQ], check[REQ], streamThenFuncWrap[REQ, EVT](ctx, thenFunc, encrypts...), encrypts...)
+}
+
+func StreamBodyReq[REQ, EVT any](ctx *gin.Context, req REQ, thenFunc streamThenFunc[REQ, EVT], encrypts ...bool) {
+	do[REQ, noResp](ctx, req, bindBody[REQ], normalize[REQ], validate[REQ], check[REQ], streamThenFuncWrap[REQ, EVT](ctx, thenFunc, encrypts...), encrypts...)
+}
+
+// streamThenFuncWrap runs the stream, an error before the first event is written
+// as the usual error response and as an error event after it
+func streamThenFuncWrap[REQ, EVT any](ctx *gin.Context, thenFunc streamThenFunc[REQ, EVT], encrypts ...bool) thenFunc[REQ, noResp] {
+	return func(req REQ) (resp noResp, err error) {
+		emitter := &Emitter[EVT]{
+			ctx:     ctx,
+			ndjson:  strings.Contains(ctx.GetHeader("Accept"), ndjsonContentType),
+			encrypt: appOf(ctx).encrypts(encrypts...),
+		}
+		if err = thenFunc(req, emitter); err != nil && !emitter.started {
+			return
+		}
+		if err != nil && !errors.Is(err, ErrNoReturn) && ctx.Request.Context().Err() == nil {
+			dd, _ := appOf(ctx).envelopeOf(http.StatusInternalServerError, http.StatusInternalServerError, "error", err, nil)
+			_ = emitter.send("error", dd)
+		}
+		emitter.start()
+		return resp, ErrNoReturn
+	}
+}
+
+// Emitter writes the events of a stream, framed as Server-Sent Events,
+// or as NDJSON when the Accept header asks for application/x-ndjson,
+// each event is encrypted on its own when the route encrypts
+type Emitter[EVT any] struct {
+	ctx     *gin.Context
+	ndjson  bool
+	encrypt bool
+	started bool
+}
+
+func (e *Emitter[EVT]) Send(evt EVT) error { return e.send("", evt) }
+
+// SendEvent sends evt named as the SSE event field, the name is dropped by NDJSON
+func (e *Emitter[EVT]) SendEvent(name string, evt EVT) error { return e.send(name, evt) }
+
+// Done is closed when the client disconnects
+func (e *Emitter[EVT]) Done() <-chan struct{} { return e.ctx.Request.Context().Done() }
+
+func (e *Emitter[EVT]) send(name string, v any) (err error) {
+	if err = e.ctx.Request.Context().Err(); err != nil {
+		return
+	}
+	var buf []byte
+	if buf, err = jsonEngine.Marshal(v); err != nil {
+		return
+	}
+	data := string(buf)
+	if e.encrypt {
+		if data, err = appOf(e.ctx).aesEncrypt(buf); err != nil {
+			return
+		}
+	}
+	e.start()
+	if e.ndjson {
+		_, err = e.ctx.Writer.WriteString(data + "\n")
+	} else {
+		e.ctx.SSEvent(name, data)
+	}
+	e.ctx.Writer.Flush()
+	return
+}
+
+func (e *Emitter[EVT]) start() {
+	if e.started {
+		return
+	}
+	e.started = true
+	header := e.ctx.Writer.Header()
+	if e.ndjson {
+		header.Set("Content-Type", ndjsonContentType)
+	} else {
+		header.Set("Content-Type", "text/event-stream")
+	}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	if e.encrypt {
+		header.Set("Encryption", "Yes")
+		if id := appOf(e.ctx).Settings().AesKeyID; id != "" {
+			header.Set(encryptionKeyIDHeader, id)
+		}
+	}
+	e.ctx.Status(http.StatusOK)
+	e.ctx.Writer.WriteHeaderNow()
+}
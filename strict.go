@@ -0,0 +1,209 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StrictBinder is the marker interface of REQ types always bound in strict mode,
+// which rejects unknown fields and duplicate form or query keys
+type StrictBinder interface{ StrictBinding() }
+
+const strictBindingKey = "strict_binding"
+
+// StrictBinding turns strict mode on for the routes using it
+func StrictBinding() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(strictBindingKey, true)
+		ctx.Next()
+	}
+}
+
+func isStrict(ctx *gin.Context, req any) bool {
+	if _, ok := req.(StrictBinder); ok {
+		return true
+	}
+	return ctx.GetBool(strictBindingKey)
+}
+
+// mapFormStrict maps form into ptr, checking the sources form merges, e.g. the query and the post form,
+// one by one in strict mode, form itself when there are none
+func mapFormStrict(ctx *gin.Context, ptr any, form map[string][]string, sources ...map[string][]string) error {
+	if isStrict(ctx, ptr) {
+		if err := checkStrictForm(ptr, "form", form, sources...); err != nil {
+			return err
+		}
+	}
+	return mapForm(ptr, form)
+}
+
+func mapSourceStrict(ctx *gin.Context, ptr any, form map[string][]string, setter setter, sources ...map[string][]string) error {
+	if isStrict(ctx, ptr) {
+		if err := checkStrictForm(ptr, "form", form, sources...); err != nil {
+			return err
+		}
+	}
+	return mappingByPtr(ptr, setter, "form")
+}
+
+// checkStrictForm rejects the keys not bound to any field and the keys repeated in a source for single value fields
+func checkStrictForm(ptr any, tag string, form map[string][]string, sources ...map[string][]string) error {
+	typ := reflect.TypeOf(ptr)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+	if len(sources) == 0 {
+		sources = []map[string][]string{form}
+	}
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	plan := cachedPlan(typ, tag)
+	var fields []FieldError
+	for _, key := range keys {
+		target, ok := plan.target(key, tag)
+		if !ok {
+			fields = append(fields, FieldError{Field: key, Reason: "unknown"})
+			continue
+		}
+		if target.Kind() == reflect.Slice || target.Kind() == reflect.Array {
+			continue
+		}
+		for _, source := range sources {
+			if len(source[key]) > 1 {
+				fields = append(fields, FieldError{Field: key, Reason: "duplicate"})
+				break
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return &BindError{Fields: fields}
+	}
+	return nil
+}
+
+// checkStrictJSON rejects the object keys of data not decoded into any field of ptr, at any depth,
+// independent of the error messages of the JSON engine
+func checkStrictJSON(data []byte, ptr any) error {
+	var doc any
+	if err := jsonEngine.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	var fields []FieldError
+	unknownJSONFields(doc, reflect.TypeOf(ptr), "", &fields)
+	if len(fields) > 0 {
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+		return &BindError{Fields: fields}
+	}
+	return nil
+}
+
+func unknownJSONFields(doc any, typ reflect.Type, path string, fields *[]FieldError) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch v := doc.(type) {
+	case map[string]any:
+		switch typ.Kind() {
+		case reflect.Struct:
+			known := jsonFieldsOf(typ)
+			for key, value := range v {
+				fieldType, ok := lookupJSONField(known, key)
+				if !ok {
+					*fields = append(*fields, FieldError{Field: joinPath(path, key), Reason: "unknown"})
+					continue
+				}
+				unknownJSONFields(value, fieldType, joinPath(path, key), fields)
+			}
+		case reflect.Map:
+			for key, value := range v {
+				unknownJSONFields(value, typ.Elem(), joinPath(path, key), fields)
+			}
+		}
+	case []any:
+		if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+			for i, value := range v {
+				unknownJSONFields(value, typ.Elem(), path+"["+strconv.Itoa(i)+"]", fields)
+			}
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var jsonFields sync.Map // reflect.Type -> map[string]reflect.Type
+
+// jsonFieldsOf returns the field types of typ by their JSON names, the fields of embedded structs promoted
+func jsonFieldsOf(typ reflect.Type) map[string]reflect.Type {
+	if fields, ok := jsonFields.Load(typ); ok {
+		return fields.(map[string]reflect.Type)
+	}
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" && !strings.HasPrefix(sf.Tag.Get("json"), "-,") {
+			continue
+		}
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range jsonFieldsOf(ft) {
+				if _, ok := fields[k]; !ok {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields[name] = sf.Type
+	}
+	jsonFields.Store(typ, fields)
+	return fields
+}
+
+// lookupJSONField matches key exactly, then case insensitively like encoding/json
+func lookupJSONField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if typ, ok := fields[key]; ok {
+		return typ, true
+	}
+	for name, typ := range fields {
+		if strings.EqualFold(name, key) {
+			return typ, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type strictAddress struct {
+	City string `json:"city" form:"city"`
+}
+
+type strictReq struct {
+	Name    string          `json:"name" form:"name"`
+	Address strictAddress   `json:"address" form:"address"`
+	Items   []strictAddress `json:"items"`
+}
+
+func (strictReq) StrictBinding() {}
+
+func TestCheckStrictJSON(t *testing.T) {
+	err := checkStrictJSON([]byte(`{"name":"a","Address":{"city":"x","zip":1},"items":[{"city":"y"},{"town":"z"}],"extra":true}`), &strictReq{})
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) {
+		t.Fatalf("want *BindError, got %v", err)
+	}
+	var got []string
+	for _, f := range bindErr.Fields {
+		got = append(got, f.Field+" "+f.Reason)
+	}
+	if strings.Join(got, ", ") != "Address.zip unknown, extra unknown, items[1].town unknown" {
+		t.Fatalf("unexpected %v", got)
+	}
+	if err = checkStrictJSON([]byte(`{"name":"a","address":{"city":"x"}}`), &strictReq{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrictFormSources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bind := func(query, body string) error {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/?"+query, strings.NewReader(body))
+		ctx.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var req strictReq
+		return bindForm(ctx, &req)
+	}
+	if err := bind("name=a", "name=b"); err != nil {
+		t.Fatalf("a key in the query and the body is not duplicate: %v", err)
+	}
+	if err := bind("", "name=a&name=b"); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("want duplicate, got %v", err)
+	}
+	if err := bind("bogus=1", ""); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("want unknown, got %v", err)
+	}
+}
+
+type strictStreamReq struct {
+	Name string     `form:"name"`
+	File FileStream `form:"file"`
+}
+
+func (strictStreamReq) StrictBinding() {}
+
+func TestStrictMultipartSources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	bind := func(query string, names []string, bindReq func(ctx *gin.Context) error) error {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for _, name := range names {
+			_ = mw.WriteField("name", name)
+		}
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		_, _ = fw.Write([]byte("data"))
+		_ = mw.Close()
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/?"+query, &body)
+		ctx.Request.Header.Set("Content-Type", mw.FormDataContentType())
+		return bindReq(ctx)
+	}
+	for _, tc := range []struct {
+		name string
+		bind func(ctx *gin.Context) error
+	}{
+		{"buffered", func(ctx *gin.Context) error { return bindForm(ctx, &strictReq{}) }},
+		{"streamed", func(ctx *gin.Context) error { return bindForm(ctx, &strictStreamReq{}) }},
+	} {
+		if err := bind("name=a", []string{"b"}, tc.bind); err != nil {
+			t.Fatalf("%s: a key in the query and the body is not duplicate: %v", tc.name, err)
+		}
+		if err := bind("", []string{"a", "b"}, tc.bind); err == nil || !strings.Contains(err.Error(), "duplicate") {
+			t.Fatalf("%s: want duplicate, got %v", tc.name, err)
+		}
+		if err := bind("bogus=1", []string{"a"}, tc.bind); err == nil || !strings.Contains(err.Error(), "unknown") {
+			t.Fatalf("%s: want unknown, got %v", tc.name, err)
+		}
+	}
+}
+
+type strictCodecReq struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+func TestStrictCodecs(t *testing.T) {
+	for _, contentType := range []string{"application/x-yaml", "application/cbor", "application/x-msgpack"} {
+		codec, ok := CodecFor(contentType)
+		if !ok {
+			continue // msgpack is left out by the nomsgpack build tag
+		}
+		data, err := codec.Marshal(map[string]any{"name": "a", "extra": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		var req strictCodecReq
+		if err = unmarshalCodec(ctx, codec, data, &req); err != nil || req.Name != "a" {
+			t.Fatalf("%s: lenient decoding got %+v, %v", codec.ContentType(), req, err)
+		}
+		ctx.Set(strictBindingKey, true)
+		if err = unmarshalCodec(ctx, codec, data, &strictCodecReq{}); err == nil {
+			t.Fatalf("%s: strict decoding accepted the unknown field", codec.ContentType())
+		}
+	}
+}
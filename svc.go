@@ -12,12 +12,12 @@
 package svc
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"reflect"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -25,125 +25,137 @@ import (
 )
 
 func Uri(ctx *gin.Context, thenFunc noReqNoRespThenFunc, encrypts ...bool) {
-	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
+	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
 }
 
 func UriReq[REQ any](ctx *gin.Context, req REQ, thenFunc reqNoRespThenFunc[REQ], encrypts ...bool) {
-	do[REQ, noResp](ctx, req, bindUri[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
+	do[REQ, noResp](ctx, req, bindUri[REQ], normalize[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
 }
 
 func UriResp[RESP any](ctx *gin.Context, thenFunc noReqRespThenFunc[RESP], encrypts ...bool) {
-	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
+	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
 }
 
 func UriReqResp[REQ, RESP any](ctx *gin.Context, req REQ, thenFunc thenFunc[REQ, RESP], encrypts ...bool) {
-	do[REQ, RESP](ctx, req, bindUri[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
+	do[REQ, RESP](ctx, req, bindUri[REQ], normalize[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
 }
 
 func Query(ctx *gin.Context, thenFunc noReqNoRespThenFunc, encrypts ...bool) {
-	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
+	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
 }
 
 func QueryReq[REQ any](ctx *gin.Context, req REQ, thenFunc reqNoRespThenFunc[REQ], encrypts ...bool) {
-	do[REQ, noResp](ctx, req, bindQuery[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
+	do[REQ, noResp](ctx, req, bindQuery[REQ], normalize[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
 }
 
 func QueryResp[RESP any](ctx *gin.Context, thenFunc noReqRespThenFunc[RESP], encrypts ...bool) {
-	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
+	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
 }
 
 func QueryReqResp[REQ, RESP any](ctx *gin.Context, req REQ, thenFunc thenFunc[REQ, RESP], encrypts ...bool) {
-	do[REQ, RESP](ctx, req, bindQuery[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
+	do[REQ, RESP](ctx, req, bindQuery[REQ], normalize[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
 }
 
 func Body(ctx *gin.Context, thenFunc noReqNoRespThenFunc, encrypts ...bool) {
-	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
+	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
 }
 
 func BodyReq[REQ any](ctx *gin.Context, req REQ, thenFunc reqNoRespThenFunc[REQ], encrypts ...bool) {
-	do[REQ, noResp](ctx, req, bindJSON[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
+	do[REQ, noResp](ctx, req, bindBody[REQ], normalize[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
 }
 
 func BodyResp[RESP any](ctx *gin.Context, thenFunc noReqRespThenFunc[RESP], encrypts ...bool) {
-	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
+	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
 }
 
 func BodyReqResp[REQ, RESP any](ctx *gin.Context, req REQ, thenFunc thenFunc[REQ, RESP], encrypts ...bool) {
-	do[REQ, RESP](ctx, req, bindJSON[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
+	do[REQ, RESP](ctx, req, bindBody[REQ], normalize[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
 }
 
 func Form(ctx *gin.Context, thenFunc noReqNoRespThenFunc, encrypts ...bool) {
-	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
+	do[noReq, noResp](ctx, noReq{}, nil, nil, nil, nil, noReqNoRespThenFuncWrap(thenFunc), encrypts...)
 }
 
 func FormReq[REQ any](ctx *gin.Context, req REQ, thenFunc reqNoRespThenFunc[REQ], encrypts ...bool) {
-	do[REQ, noResp](ctx, req, bindForm[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
+	do[REQ, noResp](ctx, req, bindForm[REQ], normalize[REQ], validate[REQ], check[REQ], reqNoRespThenFuncWrap[REQ](thenFunc), encrypts...)
 }
 
 func FormResp[RESP any](ctx *gin.Context, thenFunc noReqRespThenFunc[RESP], encrypts ...bool) {
-	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
+	do[noReq, RESP](ctx, noReq{}, nil, nil, nil, nil, noReqRespThenFuncWrap[RESP](thenFunc), encrypts...)
 }
 
 func FormReqResp[REQ, RESP any](ctx *gin.Context, req REQ, thenFunc thenFunc[REQ, RESP], encrypts ...bool) {
-	do[REQ, RESP](ctx, req, bindForm[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
+	do[REQ, RESP](ctx, req, bindForm[REQ], normalize[REQ], validate[REQ], check[REQ], thenFunc, encrypts...)
 }
 
-func do[REQ, RESP any](ctx *gin.Context, req REQ, bindFunc bindFunc[REQ], validateFunc validateFunc[REQ], checkFunc checkFunc[REQ], thenFunc thenFunc[REQ, RESP], encrypts ...bool) {
-	if fn := bindFunc; fn != nil {
-		if err := fn(ctx, &req); err != nil {
-			WriteBindError(ctx, err, encrypts...)
-			return
-		}
+func do[REQ, RESP any](ctx *gin.Context, req REQ, bindFunc bindFunc[REQ], normalizeFunc normalizeFunc[REQ], validateFunc validateFunc[REQ], checkFunc checkFunc[REQ], thenFunc thenFunc[REQ, RESP], encrypts ...bool) {
+	traceEncrypt(ctx, appOf(ctx).encrypts(encrypts...))
+	if fn := bindFunc; fn != nil && !runStage(ctx, "bind", func() error { return fn(ctx, &req) }, encrypts...) {
+		return
 	}
-	if fn := validateFunc; fn != nil {
-		if err := fn(ctx, &req); err != nil {
-			WriteBindError(ctx, err, encrypts...)
-			return
-		}
+	if fn := normalizeFunc; fn != nil {
+		fn(&req)
 	}
-	if fn := checkFunc; fn != nil {
-		if err := fn(&req); err != nil {
-			WriteBindError(ctx, err, encrypts...)
-			return
-		}
+	if fn := validateFunc; fn != nil && !runStage(ctx, "validate", func() error { return fn(ctx, &req) }, encrypts...) {
+		return
+	}
+	if fn := checkFunc; fn != nil && !runStage(ctx, "check", func() error { return fn(ctx, &req) }, encrypts...) {
+		return
 	}
 
 	if fn := thenFunc; fn != nil {
-		if resp, err := thenFunc(req); err != nil {
+		end := traceStage(ctx, "then")
+		resp, err := invoke(ctx, req, fn)
+		err = timedOut(ctx, err)
+		if err != nil {
 			if errors.Is(err, ErrNoReturn) {
 				// ignored
 				// no return everything
+			} else if bindErr := (*BindError)(nil); errors.As(err, &bindErr) {
+				WriteBindError(ctx, err, encrypts...)
 			} else {
 				WriteServerErrorJSON(ctx, err, encrypts...)
 			}
 		} else {
-			encrypt := len(encrypts) > 0 && encrypts[0] && EncryptEnable
-			if respType := reflect.TypeOf(resp); respType != nil {
-				respTypeKind := respType.Kind()
-				switch {
-				case respTypeKind == reflect.String: // for func() (str string, err error)
-					respStr := fmt.Sprintf("%v", resp)
-					if encrypt {
-						encryptStr, _ := AesEncrypt([]byte(respStr))
-						ctx.String(http.StatusOK, encryptStr)
-					} else {
-						ctx.String(http.StatusOK, respStr)
-					}
-				default:
-					WriteSuccessJSON(ctx, resp, encrypt)
-				}
-			}
+			writeResp(ctx, resp, appOf(ctx).encrypts(encrypts...))
 		}
+		end(err)
+	}
+}
+
+// runStage runs a bind, validate or check stage, writing its error, and reports whether to go on
+func runStage(ctx *gin.Context, stage string, fn func() error, encrypts ...bool) bool {
+	end := traceStage(ctx, stage)
+	err := tooLarge(fn())
+	if err != nil {
+		appOf(ctx).observeStageFailure(ctx, stage)
+		WriteBindError(ctx, err, encrypts...)
 	}
+	end(err)
+	return err == nil
 }
 
+type (
+	// Normalizer is implemented by REQ types trimming or defaulting their fields before validation
+	Normalizer interface{ Normalize() }
+
+	// Checker is implemented by REQ types checked after validation
+	Checker interface{ Check() (err error) }
+
+	// CheckerCtx is the context aware Checker
+	CheckerCtx interface {
+		Check(ctx context.Context) (err error)
+	}
+)
+
 type (
 	noReq  struct{}
 	noResp struct{}
 
 	bindFunc[REQ any]       func(ctx *gin.Context, req *REQ) (err error)
+	normalizeFunc[REQ any]  func(req *REQ)
 	validateFunc[REQ any]   func(ctx *gin.Context, req *REQ) (err error)
-	checkFunc[REQ any]      func(req *REQ) (err error)
+	checkFunc[REQ any]      func(ctx *gin.Context, req *REQ) (err error)
 	thenFunc[REQ, RESP any] func(req REQ) (resp RESP, err error)
 
 	reqNoRespThenFunc[REQ any]  func(req REQ) (err error)
@@ -187,6 +199,15 @@ func haveEncryptionData(ctx *gin.Context, dataType string) bool {
 	return b1 && b2
 }
 
+const defaultMultipartMemory = 32 << 20 // 32 MB
+
+func validateBinding(obj any) error {
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
 func bindUri[REQ any](ctx *gin.Context, req *REQ) (err error) {
 	return ctx.ShouldBindUri(req)
 }
@@ -195,56 +216,124 @@ func bindQuery[REQ any](ctx *gin.Context, req *REQ) (err error) {
 	if haveEncryptionData(ctx, "Query") {
 		if value, ok := ctx.Get("encryption_data"); ok {
 			if values, okk := value.(url.Values); okk {
-				return mapForm(req, values)
+				return mapFormStrict(ctx, req, values)
 			}
 		}
 	}
-	return ctx.ShouldBindQuery(req)
+	if err = mapFormStrict(ctx, req, ctx.Request.URL.Query()); err != nil {
+		return
+	}
+	return validateBinding(req)
 }
 
-func bindJSON[REQ any](ctx *gin.Context, req *REQ) (err error) {
+// bindBody decodes the body by the codec registered for its Content-Type, JSON by default,
+// the decrypted body by the codec of the Encryption-Content-Type header
+func bindBody[REQ any](ctx *gin.Context, req *REQ) (err error) {
 	if haveEncryptionData(ctx, "Body") {
 		if value, ok := ctx.Get("encryption_data"); ok {
 			if values, okk := value.([]byte); okk {
-				return json.Unmarshal(values, req)
+				return unmarshalBody(ctx, ctx.GetHeader("Encryption-Content-Type"), values, req)
 			}
 		}
 	}
-	return ctx.ShouldBindJSON(req)
+	if codec, ok := bodyCodec(ctx.ContentType()); ok {
+		var data []byte
+		if data, err = io.ReadAll(ctx.Request.Body); err != nil {
+			return
+		}
+		if err = unmarshalCodec(ctx, codec, data, req); err != nil {
+			return
+		}
+		return validateBinding(req)
+	}
+	if err = decodeJSON(ctx.Request.Body, req, isStrict(ctx, req)); err != nil {
+		return
+	}
+	return validateBinding(req)
+}
+
+// bodyCodec returns the registered non JSON codec of contentType
+func bodyCodec(contentType string) (Codec, bool) {
+	codec, ok := CodecFor(contentType)
+	if _, isJSON := codec.(jsonMediaCodec); isJSON {
+		return nil, false
+	}
+	return codec, ok
+}
+
+func unmarshalBody(ctx *gin.Context, contentType string, data []byte, req any) error {
+	if codec, ok := bodyCodec(contentType); ok {
+		return unmarshalCodec(ctx, codec, data, req)
+	}
+	return unmarshalJSON(ctx, data, req)
+}
+
+func unmarshalCodec(ctx *gin.Context, codec Codec, data []byte, req any) error {
+	if strictCodec, ok := codec.(StrictCodec); ok && isStrict(ctx, req) {
+		return strictCodec.UnmarshalStrict(data, req)
+	}
+	return codec.Unmarshal(data, req)
+}
+
+func unmarshalJSON(ctx *gin.Context, data []byte, req any) error {
+	if isStrict(ctx, req) {
+		return decodeJSON(bytes.NewReader(data), req, true)
+	}
+	return jsonEngine.Unmarshal(data, req)
 }
 
 func bindForm[REQ any](ctx *gin.Context, req *REQ) (err error) {
 	if haveEncryptionData(ctx, "Body") {
 		if value, ok := ctx.Get("encryption_data"); ok {
 			if values, okk := value.([]byte); okk {
-				return json.Unmarshal(values, req)
+				return unmarshalBody(ctx, ctx.GetHeader("Encryption-Content-Type"), values, req)
 			}
 		}
 	}
-	return ctx.ShouldBindWith(req, binding.Form)
-}
-
-var (
-	validatorLangSupport []string
-	validatorLangFunc    = func(ctx *gin.Context) (lang string) {
-		if lang = ctx.GetHeader("Lang"); lang != "" {
+	if hasFileStream(req) && ctx.ContentType() == binding.MIMEMultipartPOSTForm {
+		if err = bindMultipartStream(ctx, req); err != nil {
 			return
 		}
-		if lang = ctx.GetHeader("lang"); lang != "" {
+		return validateBinding(req)
+	}
+	if rules := fileRulesOf(req); len(rules) > 0 && ctx.Request.MultipartForm == nil && ctx.ContentType() == binding.MIMEMultipartPOSTForm {
+		if err = parseMultipartLimited(ctx.Request, rules); err != nil {
 			return
 		}
+	} else if err = ctx.Request.ParseMultipartForm(defaultMultipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
 		return
 	}
-)
+	if mf := ctx.Request.MultipartForm; mf != nil {
+		err = mapSourceStrict(ctx, req, ctx.Request.Form, multipartSource{values: ctx.Request.Form, files: mf.File},
+			ctx.Request.PostForm, ctx.Request.URL.Query())
+	} else {
+		err = mapFormStrict(ctx, req, ctx.Request.Form, ctx.Request.PostForm, ctx.Request.URL.Query())
+	}
+	if err != nil {
+		return
+	}
+	return validateBinding(req)
+}
+
+func defaultValidatorLangFunc(ctx *gin.Context) (lang string) {
+	if lang = ctx.GetHeader("Lang"); lang != "" {
+		return
+	}
+	if lang = ctx.GetHeader("lang"); lang != "" {
+		return
+	}
+	return
+}
 
-func ValidatorLangSupport(lang ...string)                       { validatorLangSupport = lang }
-func ValidatorLangFunc(fn func(ctx *gin.Context) (lang string)) { validatorLangFunc = fn }
+func ValidatorLangSupport(lang ...string)                       { defaultApp.validatorLangSupport = lang }
+func ValidatorLangFunc(fn func(ctx *gin.Context) (lang string)) { defaultApp.validatorLangFunc = fn }
 
 func validate[REQ any](ctx *gin.Context, req *REQ) (err error) {
-	v := validator.New(req).Lang(validatorLangSupport...)
+	app := appOf(ctx)
+	v := validator.New(req).Lang(app.validatorLangSupport...)
 	currentLang := ""
-	if len(validatorLangSupport) > 0 && validatorLangFunc != nil {
-		currentLang = validatorLangFunc(ctx)
+	if len(app.validatorLangSupport) > 0 && app.validatorLangFunc != nil {
+		currentLang = app.validatorLangFunc(ctx)
 	}
 	if vr := v.Validate(); !vr.Passed {
 		err = errors.New(vr.Messages(currentLang))
@@ -252,25 +341,18 @@ func validate[REQ any](ctx *gin.Context, req *REQ) (err error) {
 	return
 }
 
-func check[REQ any](req *REQ) (err error) {
-loop:
-	for _, value := range []reflect.Value{
-		reflect.ValueOf(req).MethodByName("Check"),
-		reflect.ValueOf(&req).MethodByName("Check"),
-	} {
-		if value.IsValid() {
-			if values := value.Call([]reflect.Value{}); values != nil && len(values) > 0 {
-				for _, val := range values {
-					if val.CanInterface() {
-						if inter := val.Interface(); inter != nil {
-							if err = inter.(error); err != nil {
-								break loop
-							}
-						}
-					}
-				}
-			}
-		}
+func normalize[REQ any](req *REQ) {
+	if n, ok := any(req).(Normalizer); ok {
+		n.Normalize()
+	}
+}
+
+func check[REQ any](ctx *gin.Context, req *REQ) (err error) {
+	switch c := any(req).(type) {
+	case Checker:
+		err = c.Check()
+	case CheckerCtx:
+		err = c.Check(ctx)
 	}
 	return
 }
@@ -0,0 +1,155 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/go-the-way/svc"
+
+type TracingOption struct {
+	TracerProvider trace.TracerProvider          // otel.GetTracerProvider() when nil
+	Propagator     propagation.TextMapPropagator // W3C trace context and baggage when nil
+}
+
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+type tracingCtxKey struct{}
+
+var defaultPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracing starts a server span per request named by the route template, continuing the trace of traceparent,
+// the svc handlers of the route record the spans of their bind, validate, check and then stages under it
+func Tracing(configure ...func(opt *TracingOption)) gin.HandlerFunc {
+	var opt TracingOption
+	for _, conf := range configure {
+		if conf != nil {
+			conf(&opt)
+		}
+	}
+	if opt.TracerProvider == nil {
+		opt.TracerProvider = otel.GetTracerProvider()
+	}
+	if opt.Propagator == nil {
+		opt.Propagator = defaultPropagator
+	}
+	t := &tracing{tracer: opt.TracerProvider.Tracer(tracerName), propagator: opt.Propagator}
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		reqCtx := opt.Propagator.Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		reqCtx = context.WithValue(reqCtx, tracingCtxKey{}, t)
+		reqCtx, span := t.tracer.Start(reqCtx, ctx.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", ctx.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", ctx.Request.URL.Path),
+				attribute.String("client.address", ctx.ClientIP()),
+				attribute.Bool("svc.decrypt", appOf(ctx).decryptEnabled() && encrypted(ctx.Request.Header)),
+			))
+		defer span.End()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if code, ok := ctx.Get(respCodeKey); ok {
+			if c, okk := code.(int); okk {
+				span.SetAttributes(attribute.Int("svc.code", c))
+			}
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, ctx.GetString(respErrorKey))
+		}
+	}
+}
+
+func tracingOf(ctx context.Context) *tracing {
+	if t, ok := ctx.Value(tracingCtxKey{}).(*tracing); ok {
+		return t
+	}
+	return nil
+}
+
+// requestContext returns the request context of a *gin.Context, ctx itself otherwise
+func requestContext(ctx context.Context) context.Context {
+	if ginCtx, ok := ctx.(*gin.Context); ok && ginCtx.Request != nil {
+		return ginCtx.Request.Context()
+	}
+	return ctx
+}
+
+// traceStage starts the span of a pipeline stage on traced routes, the request context carries it
+// until end, which records err
+func traceStage(ctx *gin.Context, stage string, attrs ...attribute.KeyValue) (end func(err error)) {
+	parent := ctx.Request.Context()
+	t := tracingOf(parent)
+	if t == nil {
+		return func(error) {}
+	}
+	stageCtx, span := t.tracer.Start(parent, "svc."+stage, trace.WithAttributes(attrs...))
+	ctx.Request = ctx.Request.WithContext(stageCtx)
+	return func(err error) {
+		if err != nil && !errors.Is(err, ErrNoReturn) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		if code, ok := ctx.Get(respCodeKey); ok {
+			if c, okk := code.(int); okk {
+				span.SetAttributes(attribute.Int("svc.code", c))
+			}
+		}
+		span.End()
+		ctx.Request = ctx.Request.WithContext(parent)
+	}
+}
+
+// traceClient starts the client span of req, injecting the trace headers into it
+func traceClient(ctx context.Context, req *http.Request) (*http.Request, trace.Span) {
+	t := tracingOf(ctx)
+	if t == nil {
+		t = &tracing{tracer: otel.Tracer(tracerName), propagator: defaultPropagator}
+	}
+	ctx, span := t.tracer.Start(ctx, "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("server.address", req.URL.Host),
+		))
+	req = req.WithContext(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+// traceEncrypt records on the server span whether the response of the route is encrypted
+func traceEncrypt(ctx *gin.Context, encrypt bool) {
+	if span := trace.SpanFromContext(ctx.Request.Context()); span.IsRecording() {
+		span.SetAttributes(attribute.Bool("svc.encrypt", encrypt))
+	}
+}
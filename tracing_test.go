@@ -0,0 +1,173 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type tracedReq struct {
+	Name string `json:"name"`
+}
+
+func newTracedApp(t *testing.T) (*App, *tracetest.InMemoryExporter) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	app := New()
+	app.Use(Tracing(func(opt *TracingOption) { opt.TracerProvider = provider }))
+	return app, exporter
+}
+
+func spansByName(spans tracetest.SpanStubs) map[string]tracetest.SpanStub {
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	return byName
+}
+
+func postJSON(app *App, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	app.ServeHTTP(w, r)
+	return w
+}
+
+func TestTracingStageSpans(t *testing.T) {
+	app, exporter := newTracedApp(t)
+	app.POST("/greet", func(ctx *gin.Context) {
+		BodyReqResp(ctx, tracedReq{}, func(req tracedReq) (string, error) { return "hi " + req.Name, nil })
+	})
+	if w := postJSON(app, "/greet", `{"name":"a"}`); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	spans := spansByName(exporter.GetSpans())
+	server, ok := spans["POST /greet"]
+	if !ok {
+		t.Fatalf("no server span in %v", spans)
+	}
+	for _, stage := range []string{"bind", "validate", "check", "then"} {
+		span, found := spans["svc."+stage]
+		if !found {
+			t.Fatalf("no svc.%s span", stage)
+		}
+		if span.Parent.SpanID() != server.SpanContext.SpanID() || span.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Fatalf("svc.%s is not a child of the server span", stage)
+		}
+		if span.Status.Code == codes.Error {
+			t.Fatalf("svc.%s has error status", stage)
+		}
+	}
+}
+
+func TestTracingErrorStatus(t *testing.T) {
+	app, exporter := newTracedApp(t)
+	app.POST("/fail", func(ctx *gin.Context) {
+		BodyReqResp(ctx, tracedReq{}, func(req tracedReq) (string, error) { return "", errors.New("boom") })
+	})
+	if w := postJSON(app, "/fail", `{"name":"a"}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d", w.Code)
+	}
+	spans := spansByName(exporter.GetSpans())
+	if then := spans["svc.then"]; then.Status.Code != codes.Error || then.Status.Description != "boom" {
+		t.Fatalf("svc.then status %+v", then.Status)
+	}
+	if server := spans["POST /fail"]; server.Status.Code != codes.Error {
+		t.Fatalf("server span status %+v", server.Status)
+	}
+
+	exporter.Reset()
+	if w := postJSON(app, "/fail", `{`); w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d", w.Code)
+	}
+	spans = spansByName(exporter.GetSpans())
+	if bind := spans["svc.bind"]; bind.Status.Code != codes.Error {
+		t.Fatalf("svc.bind status %+v", bind.Status)
+	}
+	if _, ok := spans["svc.then"]; ok {
+		t.Fatal("svc.then recorded after a failed bind")
+	}
+}
+
+func TestTracingPropagatesTraceparent(t *testing.T) {
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		_, _ = w.Write([]byte(`{"code":200}`))
+	}))
+	defer upstream.Close()
+	app, exporter := newTracedApp(t)
+	app.POST("/proxy", func(ctx *gin.Context) {
+		BodyReqResp(ctx, tracedReq{}, func(req tracedReq) (string, error) {
+			_, _, err := HttpDoCtx[any, map[string]any](ctx, http.MethodGet, upstream.URL, nil, nil)
+			return "ok", err
+		})
+	})
+	if w := postJSON(app, "/proxy", `{"name":"a"}`); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	spans := spansByName(exporter.GetSpans())
+	client, ok := spans["HTTP GET"]
+	if !ok {
+		t.Fatalf("no client span in %v", spans)
+	}
+	if client.Parent.SpanID() != spans["svc.then"].SpanContext.SpanID() {
+		t.Fatal("the client span is not a child of svc.then")
+	}
+	want := "00-" + client.SpanContext.TraceID().String() + "-" + client.SpanContext.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Fatalf("traceparent %q, want %q", traceparent, want)
+	}
+}
+
+func TestTracingExtractsTraceparent(t *testing.T) {
+	app, exporter := newTracedApp(t)
+	app.POST("/greet", func(ctx *gin.Context) {
+		BodyReqResp(ctx, tracedReq{}, func(req tracedReq) (string, error) { return "hi " + req.Name, nil })
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(`{"name":"a"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("Encryption", "No")
+	app.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	server, ok := spansByName(exporter.GetSpans())["POST /greet"]
+	if !ok {
+		t.Fatal("no server span")
+	}
+	if server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		server.Parent.SpanID().String() != "00f067aa0ba902b7" || !server.Parent.IsRemote() {
+		t.Fatalf("the server span is not a child of the traceparent: %v, parent %v", server.SpanContext, server.Parent)
+	}
+	for _, attr := range server.Attributes {
+		if attr.Key == "svc.decrypt" && attr.Value.AsBool() {
+			t.Fatal("svc.decrypt is true for Encryption: No")
+		}
+	}
+}
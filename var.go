@@ -11,11 +11,22 @@
 
 package svc
 
-import "os"
+import "log/slog"
+
+// envConfig is the Config of the environment, the package level encryption settings below default to it
+var envConfig = loadEnvConfig()
+
+func loadEnvConfig() Config {
+	cfg, err := LoadConfig()
+	if err != nil {
+		slog.Warn("svc: config of env", "err", err)
+	}
+	return cfg
+}
 
 var (
-	EncryptEnable = os.Getenv("ENCRYPT_ENABLE") == "T"
-	DecryptEnable = os.Getenv("DECRYPT_ENABLE") == "T"
+	EncryptEnable = envConfig.EncryptEnable
+	DecryptEnable = envConfig.DecryptEnable
 )
 
-func AesKey() string { return os.Getenv("AES_KEY") }
+func AesKey() string { return envConfig.AesKey }
@@ -0,0 +1,179 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketUpgrader upgrades the connections of WebSocket, its default CheckOrigin
+// rejects cross origin requests
+var WebSocketUpgrader = &websocket.Upgrader{}
+
+type wsThenFunc[IN, OUT any] func(in IN, conn *WSConn[OUT]) (err error)
+
+// WebSocket upgrades the request and calls thenFunc with every inbound message decoded into IN
+// by the codec negotiated like responses, after the normalize, validate and check steps of the pipeline.
+// The failures of a message are sent back in the response envelope and the connection keeps reading,
+// messages are decrypted and encrypted when the route encrypts.
+// The connection is closed with 1001 going away once the App shuts down by Run or the context of the request is done.
+func WebSocket[IN, OUT any](ctx *gin.Context, thenFunc wsThenFunc[IN, OUT], encrypts ...bool) {
+	app := appOf(ctx)
+	encrypted := len(encrypts) > 0 && encrypts[0]
+	rawConn, err := WebSocketUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		return // the upgrader has replied with an HTTP error
+	}
+	conn := &WSConn[OUT]{app: app, conn: rawConn, codec: negotiateCodec(ctx), encrypt: app.encrypts(encrypts...)}
+	defer func() { _ = conn.Close() }()
+	defer app.trackWebSocket(conn)()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Request.Context().Done():
+			_ = conn.closeWith(websocket.CloseGoingAway)
+		case <-done:
+		}
+	}()
+	for {
+		_, data, rErr := rawConn.ReadMessage()
+		if rErr != nil {
+			return
+		}
+		if encrypted && app.decryptEnabled() {
+			if data, err = app.aesDecrypt(ctx.GetHeader(encryptionKeyIDHeader), data); err != nil {
+				_ = conn.writeError(http.StatusBadRequest, err)
+				continue
+			}
+		}
+		var in IN
+		if err = conn.decode(ctx, data, &in); err != nil {
+			_ = conn.writeError(http.StatusBadRequest, err)
+			continue
+		}
+		normalize(&in)
+		if err = validate(ctx, &in); err != nil {
+			_ = conn.writeError(http.StatusBadRequest, err)
+			continue
+		}
+		if err = check(ctx, &in); err != nil {
+			_ = conn.writeError(http.StatusBadRequest, err)
+			continue
+		}
+		if err = thenFunc(in, conn); err != nil && !errors.Is(err, ErrNoReturn) {
+			_ = conn.writeError(http.StatusInternalServerError, err)
+		}
+	}
+}
+
+type wsCloser interface{ closeWith(code int) error }
+
+// trackWebSocket records conn as open until the returned func is called
+func (app *App) trackWebSocket(conn wsCloser) (untrack func()) {
+	app.wsMu.Lock()
+	if app.wsConns == nil {
+		app.wsConns = map[wsCloser]struct{}{}
+	}
+	app.wsConns[conn] = struct{}{}
+	app.wsMu.Unlock()
+	return func() {
+		app.wsMu.Lock()
+		delete(app.wsConns, conn)
+		app.wsMu.Unlock()
+	}
+}
+
+// closeWebSockets closes the open WebSocket connections with 1001 going away,
+// http.Server.Shutdown does not close the hijacked connections
+func (app *App) closeWebSockets() {
+	app.wsMu.Lock()
+	conns := make([]wsCloser, 0, len(app.wsConns))
+	for conn := range app.wsConns {
+		conns = append(conns, conn)
+	}
+	app.wsMu.Unlock()
+	for _, conn := range conns {
+		_ = conn.closeWith(websocket.CloseGoingAway)
+	}
+}
+
+// WSConn sends OUT messages in the response envelope, it is safe for concurrent use
+type WSConn[OUT any] struct {
+	app     *App
+	conn    *websocket.Conn
+	codec   Codec
+	encrypt bool
+	mu      sync.Mutex
+}
+
+func (c *WSConn[OUT]) Send(out OUT) error {
+	dd, _ := c.app.envelopeOf(http.StatusOK, http.StatusOK, "", nil, out)
+	return c.write(dd)
+}
+
+func (c *WSConn[OUT]) Close() error { return c.conn.Close() }
+
+// closeWith sends the close frame of code before closing the connection
+func (c *WSConn[OUT]) closeWith(code int) error {
+	c.mu.Lock()
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	c.mu.Unlock()
+	return c.conn.Close()
+}
+
+func (c *WSConn[OUT]) decode(ctx *gin.Context, data []byte, in any) error {
+	if _, isJSON := c.codec.(jsonMediaCodec); isJSON {
+		return unmarshalJSON(ctx, data, in)
+	}
+	return unmarshalCodec(ctx, c.codec, data, in)
+}
+
+func (c *WSConn[OUT]) writeError(code int, err error) error {
+	var data any
+	var bindErr *BindError
+	if errors.As(err, &bindErr) {
+		data = bindErr.Fields
+	}
+	dd, _ := c.app.envelopeOf(code, code, "", err, data)
+	return c.write(dd)
+}
+
+func (c *WSConn[OUT]) write(dd any) error {
+	codec := c.codec
+	buf, err := codec.Marshal(dd)
+	if err != nil {
+		return fmt.Errorf("svc: marshal %s frame: %w", codec.ContentType(), err)
+	}
+	messageType := websocket.BinaryMessage
+	switch codec.(type) {
+	case jsonMediaCodec, xmlCodec, yamlCodec:
+		messageType = websocket.TextMessage
+	}
+	if c.encrypt {
+		encryptStr, eErr := c.app.aesEncrypt(buf)
+		if eErr != nil {
+			return eErr
+		}
+		messageType, buf = websocket.TextMessage, []byte(encryptStr)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteMessage(messageType, buf)
+}
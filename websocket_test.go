@@ -0,0 +1,180 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type (
+	wsIn struct {
+		Name string `json:"name"`
+	}
+	wsOut struct {
+		Hello string `json:"hello"`
+	}
+	wsEnvelope struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data wsOut  `json:"data"`
+	}
+)
+
+// newWSServer serves the echo WebSocket route, cancel ends the request context of the connections
+func newWSServer(t *testing.T) (url string, cancel context.CancelFunc) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	reqCtx, cancel := context.WithCancel(context.Background())
+	app := New()
+	app.GET("/ws", func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		WebSocket[wsIn, wsOut](ctx, func(in wsIn, conn *WSConn[wsOut]) error {
+			return conn.Send(wsOut{Hello: in.Name})
+		})
+	})
+	srv := httptest.NewServer(app)
+	t.Cleanup(srv.Close)
+	t.Cleanup(cancel)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws", cancel
+}
+
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status %d", resp.StatusCode)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestWebSocketRoundTrip(t *testing.T) {
+	url, _ := newWSServer(t)
+	conn := dialWS(t, url)
+	for _, name := range []string{"a", "b"} {
+		if err := conn.WriteJSON(wsIn{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		var env wsEnvelope
+		if err := conn.ReadJSON(&env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Code != http.StatusOK || env.Data.Hello != name {
+			t.Fatalf("got %+v", env)
+		}
+	}
+}
+
+func TestWebSocketErrorFrame(t *testing.T) {
+	url, _ := newWSServer(t)
+	conn := dialWS(t, url)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	var env wsEnvelope
+	if err := conn.ReadJSON(&env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Code != http.StatusBadRequest || env.Msg == "" {
+		t.Fatalf("got %+v", env)
+	}
+	// the connection keeps serving after a bad message
+	if err := conn.WriteJSON(wsIn{Name: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ReadJSON(&env); err != nil || env.Data.Hello != "c" {
+		t.Fatalf("got %+v, %v", env, err)
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	url, _ := newWSServer(t)
+	resp, err := http.Get("http" + strings.TrimPrefix(url, "ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET got %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketCloseOnCancel(t *testing.T) {
+	url, cancel := newWSServer(t)
+	conn := dialWS(t, url)
+	cancel()
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("want close 1001, got %v", err)
+	}
+}
+
+func TestWebSocketCloseOnShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New()
+	app.GET("/ws", func(ctx *gin.Context) {
+		WebSocket[wsIn, wsOut](ctx, func(in wsIn, conn *WSConn[wsOut]) error {
+			return conn.Send(wsOut{Hello: in.Name})
+		})
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals := make(chan os.Signal, 1)
+	ran := make(chan error, 1)
+	go func() {
+		ran <- app.Run("", func(opt *RunOption) {
+			opt.Listener, opt.Signals, opt.ShutdownTimeout = ln, signals, 5*time.Second
+		})
+	}()
+	conn := dialWS(t, "ws://"+ln.Addr().String()+"/ws")
+	// a round trip makes sure the handler is serving the connection
+	var env wsEnvelope
+	if err = conn.WriteJSON(wsIn{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.ReadJSON(&env); err != nil {
+		t.Fatal(err)
+	}
+	signals <- syscall.SIGTERM
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("want close 1001, got %v", err)
+	}
+	select {
+	case err = <-ran:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+}
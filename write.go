@@ -12,20 +12,80 @@
 package svc
 
 import (
-	"encoding/json"
+	"encoding/xml"
 	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+const jsonContentType = "application/json; charset=utf-8"
+
+// ErrNotAcceptable is answered when the response can not be rendered by the negotiated codec
+var ErrNotAcceptable = NewErrorWithCodes("not acceptable", http.StatusNotAcceptable, http.StatusNotAcceptable)
+
 type kv struct {
-	Code int    `json:"code,omitempty"`
-	Msg  string `json:"msg,omitempty"`
-	Data any    `json:"data,omitempty"`
+	XMLName   xml.Name `json:"-" xml:"response" yaml:"-"`
+	Code      int      `json:"code,omitempty" xml:"code,omitempty" yaml:"code,omitempty"`
+	Msg       string   `json:"msg,omitempty" xml:"msg,omitempty" yaml:"msg,omitempty"`
+	Data      any      `json:"data,omitempty" xml:"data,omitempty" yaml:"data,omitempty"`
+	RequestID string   `json:"request_id,omitempty" xml:"request_id,omitempty" yaml:"request_id,omitempty"`
 }
 
 func WriteJSON(ctx *gin.Context, code, httpCode int, msg string, err error, data any, encrypts ...bool) {
+	app := appOf(ctx)
+	env, httpCode := app.kvOf(code, httpCode, msg, err, data)
+	ctx.Set(respCodeKey, env.Code)
+	if err != nil {
+		ctx.Set(respErrorKey, env.Msg)
+		env.RequestID = RequestIDOf(ctx)
+		app.keepRequestID(ctx, env.RequestID)
+	}
+	dd := app.wrap(env)
+	encrypt := app.encrypts(encrypts...)
+	codec := negotiateCodec(ctx)
+	marshalBytes, mErr := codec.Marshal(dd)
+	if mErr != nil {
+		// the negotiated codec can not render the response, which is answered in JSON with 406
+		slog.Error("svc: marshal response", "content_type", codec.ContentType(), "err", mErr)
+		env, httpCode = app.kvOf(0, 0, "", ErrNotAcceptable, nil)
+		ctx.Set(respCodeKey, env.Code)
+		ctx.Set(respErrorKey, env.Msg)
+		env.RequestID = RequestIDOf(ctx)
+		app.keepRequestID(ctx, env.RequestID)
+		dd = app.wrap(env)
+		codec = jsonMediaCodec{}
+		marshalBytes, _ = jsonEngine.Marshal(dd)
+	}
+	if ctx.GetBool(accessLogBodyKey) {
+		ctx.Set(respBodyKey, marshalBytes)
+	}
+	if encrypt {
+		encryptStr, _ := app.encryptTo(ctx.Writer.Header(), codec.ContentType(), marshalBytes)
+		ctx.String(httpCode, encryptStr)
+		return
+	}
+	contentType := codec.ContentType()
+	if _, isJSON := codec.(jsonMediaCodec); isJSON {
+		contentType = jsonContentType
+	}
+	ctx.Data(httpCode, contentType, marshalBytes)
+}
+
+// envelopeOf builds the response envelope, err is mapped by the ErrorMapper of app
+// and the codes of *Error override code and httpCode
+func (app *App) envelopeOf(code, httpCode int, msg string, err error, data any) (any, int) {
+	dd, httpCode := app.kvOf(code, httpCode, msg, err, data)
+	return app.wrap(dd), httpCode
+}
+
+func (app *App) kvOf(code, httpCode int, msg string, err error, data any) (kv, int) {
+	for _, mapper := range app.errorMappers {
+		if err != nil && mapper != nil {
+			err = mapper(err)
+		}
+	}
 	dd := kv{Code: code, Msg: msg, Data: data}
 	if err != nil {
 		dd.Msg = err.Error()
@@ -39,15 +99,22 @@ func WriteJSON(ctx *gin.Context, code, httpCode int, msg string, err error, data
 			}
 		}
 	}
-	encrypt := len(encrypts) > 0 && encrypts[0] && EncryptEnable
-	if encrypt {
-		marshalBytes, _ := json.Marshal(dd)
-		encryptStr, _ := AesEncrypt(marshalBytes)
-		ctx.Writer.Header().Set("Encryption", "Yes")
-		ctx.String(httpCode, encryptStr)
-		return
+	return dd, httpCode
+}
+
+// keepRequestID answers id in the RequestIDHeader when the Envelope of app leaves it out of the body
+func (app *App) keepRequestID(ctx *gin.Context, id string) {
+	if app.envelope != nil && id != "" && ctx.Writer.Header().Get(RequestIDHeader) == "" {
+		ctx.Header(RequestIDHeader, id)
+	}
+}
+
+// wrap returns dd in the Envelope of app if any
+func (app *App) wrap(dd kv) any {
+	if app.envelope != nil {
+		return app.envelope(dd.Code, dd.Msg, dd.Data)
 	}
-	ctx.JSON(httpCode, dd)
+	return dd
 }
 
 func WriteSuccessJSON(ctx *gin.Context, data any, encrypts ...bool) {
@@ -59,7 +126,12 @@ func WriteServerErrorJSON(ctx *gin.Context, err error, encrypts ...bool) {
 }
 
 func WriteBindError(ctx *gin.Context, err error, encrypts ...bool) {
-	WriteJSON(ctx, http.StatusBadRequest, http.StatusBadRequest, "", err, nil, encrypts...)
+	var data any
+	var bindErr *BindError
+	if errors.As(err, &bindErr) {
+		data = bindErr.Fields
+	}
+	WriteJSON(ctx, http.StatusBadRequest, http.StatusBadRequest, "", err, data, encrypts...)
 }
 
 func WriteMessageJSON(ctx *gin.Context, httpCode int, str string, encrypts ...bool) {
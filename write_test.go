@@ -0,0 +1,37 @@
+// Copyright 2024 svc Author. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//      http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package svc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEnvelopeKeepsRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := New(WithEnvelope(func(code int, msg string, data any) any {
+		return map[string]any{"status": code, "message": msg}
+	}))
+	app.GET("/fail", func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(WithRequestID(ctx.Request.Context(), "req-1"))
+		WriteServerErrorJSON(ctx, errors.New("boom"))
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get(RequestIDHeader) != "req-1" {
+		t.Fatalf("got %d %v", w.Code, w.Header())
+	}
+}